@@ -0,0 +1,53 @@
+package ntrip
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authorize checks the Basic credentials of a request against the
+// configured users and the mountpoint's access list. Access is open when
+// no users are configured.
+func (s *Server) authorize(m *mountpoint, authorization string) (string, bool) {
+	s.mu.RLock()
+	users, allowed := s.config.Server.Users, m.users
+	s.mu.RUnlock()
+	if len(users) == 0 {
+		return "", true
+	}
+
+	scheme, encoded, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return username, false
+	}
+
+	stored, ok := users[username]
+	if !ok || !checkPassword(stored, password) {
+		return username, false
+	}
+	if len(allowed) > 0 && !slices.Contains(allowed, username) {
+		return username, false
+	}
+	return username, true
+}
+
+// checkPassword compares a password against a stored bcrypt hash, or
+// against the plaintext value when it is not a hash
+func checkPassword(stored, password string) bool {
+	if strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
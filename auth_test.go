@@ -0,0 +1,59 @@
+package ntrip
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthorize(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("rover"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	config.Server.Users = map[string]string{"alice": "secret", "bob": string(hash)}
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}, {Name: "PRIVATE", Users: []string{"alice"}}}
+	s := NewServer(config)
+
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+	tests := []struct {
+		name          string
+		mountpoint    string
+		authorization string
+		user          string
+		ok            bool
+	}{
+		{name: "missing header", mountpoint: "RTCM3", authorization: ""},
+		{name: "wrong password", mountpoint: "RTCM3", authorization: basic("alice:wrong"), user: "alice"},
+		{name: "unknown user", mountpoint: "RTCM3", authorization: basic("mallory:secret"), user: "mallory"},
+		{name: "no password", mountpoint: "RTCM3", authorization: basic("alice"), user: "alice"},
+		{name: "other scheme", mountpoint: "RTCM3", authorization: "Bearer " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))},
+		{name: "invalid base64", mountpoint: "RTCM3", authorization: "Basic !!!"},
+		{name: "valid plaintext", mountpoint: "RTCM3", authorization: basic("alice:secret"), user: "alice", ok: true},
+		{name: "valid bcrypt", mountpoint: "RTCM3", authorization: basic("bob:rover"), user: "bob", ok: true},
+		{name: "lower case scheme", mountpoint: "RTCM3", authorization: "basic " + base64.StdEncoding.EncodeToString([]byte("bob:rover")), user: "bob", ok: true},
+		{name: "allowed on mountpoint", mountpoint: "PRIVATE", authorization: basic("alice:secret"), user: "alice", ok: true},
+		{name: "not allowed on mountpoint", mountpoint: "PRIVATE", authorization: basic("bob:rover"), user: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := s.authorize(s.mounts[tt.mountpoint], tt.authorization)
+			if user != tt.user || ok != tt.ok {
+				t.Errorf("authorize = %q, %v, want %q, %v", user, ok, tt.user, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAuthorizeOpenWithoutUsers(t *testing.T) {
+	var config Config
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	s := NewServer(config)
+	if _, ok := s.authorize(s.mounts["RTCM3"], ""); !ok {
+		t.Error("request without credentials refused although no users are configured")
+	}
+}
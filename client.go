@@ -1,131 +1,969 @@
-package main
+package ntrip
 
 import (
-	"flag"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
-	"os"
+	"net/http/httputil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+
+	"ntrip/rtcm"
+)
+
+// NTRIP protocol versions
+const (
+	NtripV1 = 1
+	NtripV2 = 2
+)
+
+const (
+	// maxRetryInterval caps the reconnect backoff
+	maxRetryInterval = time.Minute
+	// defaultClientPort and defaultTLSPort are used when ServerAddr has no
+	// port
+	defaultClientPort = "2101"
+	defaultTLSPort    = "2102"
+	// stablePeriod is how long a connection must stream before the
+	// reconnect backoff is reset
+	stablePeriod = 30 * time.Second
+)
+
+// ErrConnectTimeout and ErrHeaderTimeout are wrapped by the errors
+// returned when the caster cannot be reached, or accepts the connection
+// but never answers the request, within the connect timeout
+var (
+	ErrConnectTimeout = errors.New("timed out connecting to caster")
+	ErrHeaderTimeout  = errors.New("timed out waiting for caster response")
 )
 
-type NtripClient struct {
-	serverAddr string
-	mountpoint string
-	username   string
-	password   string
-	outputFile string
+// Client pulls a mountpoint's RTCM stream from a caster into a file
+type Client struct {
+	// ServerAddr is the caster's host[:port], or unix:/path/to.sock
+	ServerAddr string
+	Mountpoint string
+	Username   string
+	Password   string
+	OutputFile string
+	// Version is the NTRIP protocol version to request, NtripV1 or NtripV2
+	Version int
+	// UserAgent replaces the default "NTRIP/<Version>". Headers are sent
+	// after the built-in ones, see ParseHeader.
+	UserAgent string
+	Headers   []Header
+	// GGA is a literal NMEA GGA sentence, or "lat,lon[,alt]" in decimal
+	// degrees from which one is generated, uploaded for VRS casters
+	GGA         string
+	GGAInterval time.Duration
+	// GGAFile, instead of GGA, is re-read on every send for the latest
+	// sentence, see ReadGGAFile. A send is skipped while the file is
+	// missing or invalid.
+	GGAFile string
+
+	// TLS connects over TLS, verifying the caster's certificate against
+	// its hostname unless TLSInsecure is set
+	TLS         bool
+	TLSInsecure bool
+	// Proxy is an http:// (CONNECT) or socks5:// proxy URL, optionally
+	// with user:password, the caster is reached through. Empty connects
+	// directly, see ProxyFromEnvironment for the usual variables.
+	Proxy string
+	// ConnectTimeout bounds connecting to the caster and, separately,
+	// waiting for its response. 0 uses dialTimeout.
+	ConnectTimeout time.Duration
+	// TCPKeepalive is the TCP keepalive period of the caster connection.
+	// 0 keeps Go's default of 15s and a negative value disables keepalives.
+	TCPKeepalive time.Duration
+	// ReadBufferSize is the most read from the caster in one call, 0 for
+	// defaultReadBufferSize
+	ReadBufferSize int
+
+	// Data, when set, receives a copy of every chunk of the stream as it
+	// is written to the output file
+	Data chan<- []byte
+	// Stdout, when set, also receives the raw stream, for piping into a
+	// decoder. Status messages always go to the log.
+	Stdout io.Writer
+	// Serial, when set, also receives the raw stream, typically a GNSS
+	// receiver's correction port opened with OpenSerialPort
+	Serial io.Writer
+	// Command, when set, also receives the raw stream, typically a
+	// CommandWriter feeding another program
+	Command io.Writer
+
+	// Retry enables reconnecting with exponential backoff
+	Retry         bool
+	RetryInterval time.Duration
+	MaxRetries    int
+
+	// Failover lists backup casters tried in turn when the connection is
+	// lost, implying Retry. After FailoverCooldown on a backup the client
+	// returns to the primary. DataTimeout, when non-zero, treats a stream
+	// that delivers nothing for that long as lost.
+	Failover         []Endpoint
+	FailoverCooldown time.Duration
+	DataTimeout      time.Duration
+
+	// RotateSize and RotateInterval, when non-zero, start a new timestamped
+	// output file once the current one reaches that size or age. Compress
+	// gzips each rotated-out file.
+	RotateSize     int64
+	RotateInterval time.Duration
+	Compress       bool
+	// FlushInterval, when non-zero, buffers output file writes in memory
+	// and flushes them this often, and when the file is closed
+	FlushInterval time.Duration
+	// OutputDir, when set, is the directory output files are created in.
+	// NameTemplate replaces the default "<output>_<start time>" file name,
+	// see TimestampedName. Missing directories are created.
+	OutputDir    string
+	NameTemplate string
+	// Timestamped writes each chunk to the output file as a record with
+	// its arrival time and length instead of raw, see RecordReader
+	Timestamped bool
+	// MaxTotalBytes and MinFreeBytes, when non-zero, stop writing the
+	// output file once the files of this run would exceed MaxTotalBytes in
+	// total, or the output volume would have less than MinFreeBytes free.
+	// With PruneOutput the oldest rotated-out files of the run are deleted
+	// first to make room. ExitOnDiskGuard makes Run return ErrDiskGuard
+	// instead of carrying on with the other outputs.
+	MaxTotalBytes   int64
+	MinFreeBytes    int64
+	PruneOutput     bool
+	ExitOnDiskGuard bool
+	// CheckContinuity watches the epoch times of observation messages and
+	// warns about gaps, see Gaps
+	CheckContinuity bool
+	// SniffRTCM checks the start of every connection's stream for a valid
+	// RTCM 3 frame before anything is written, warning when there is none,
+	// as for a mistyped mountpoint answered with HTML or NMEA. With
+	// RequireRTCM, which implies it, Run fails with ErrNotRTCM instead.
+	SniffRTCM   bool
+	RequireRTCM bool
+	// Sidecar writes a CaptureInfo as <output>.json next to the first
+	// output file of the run, rewritten every SidecarInterval (a minute
+	// by default) while capturing and marked complete once the client
+	// stops
+	Sidecar         bool
+	SidecarInterval time.Duration
+
+	outputBase     string
+	sidecarWritten time.Time    // When the sidecar was last written
+	outputs        []outputFile // Files written in this run, oldest first
+	guarded        bool         // Output stopped by the disk guard
+
+	mu         sync.Mutex
+	counts     map[int]int          // Frames received per RTCM message type
+	received   int64                // Stream bytes received
+	rate       rateMeter            // Bitrate of the stream
+	continuity *rtcm.Continuity     // Nil unless CheckContinuity is set
+	messages   chan ReceivedMessage // Nil until Messages is called
+	capture    CaptureInfo          // Sidecar metadata gathered so far
 }
 
-func NewNtripClient(serverAddr, mountpoint, username, password, outputFile string) *NtripClient {
-	return &NtripClient{
-		serverAddr: serverAddr,
-		mountpoint: mountpoint,
-		username:   username,
-		password:   password,
-		outputFile: outputFile,
+// bufferedConn reads through a bufio.Reader so that bytes buffered while
+// parsing the response are not lost
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// ntripResponse holds the parsed status line and headers of a caster response
+type ntripResponse struct {
+	proto   string
+	status  int
+	header  map[string]string
+	chunked bool
+	// records are the STR, CAS and NET lines some casters, such as the
+	// BKG Professional NTRIP Caster, send with the response to describe
+	// the stream
+	records SourceTable
+}
+
+// NewClient returns a client for NTRIP v1 writing to outputFile
+func NewClient(serverAddr, mountpoint, username, password, outputFile string) *Client {
+	return &Client{
+		ServerAddr: serverAddr,
+		Mountpoint: mountpoint,
+		Username:   username,
+		Password:   password,
+		OutputFile: outputFile,
+		Version:    NtripV1,
+		outputBase: outputFile,
 	}
 }
 
-func (c *NtripClient) Connect() error {
-	// Connect to the NTRIP server
-	conn, err := net.Dial("tcp", c.serverAddr)
+// basicAuth returns the base64 encoded "user:pass" credentials for the
+// Authorization header, or an empty string when no username is set
+func basicAuth(username, password string) string {
+	username = strings.TrimRightFunc(username, unicode.IsSpace)
+	password = strings.TrimRightFunc(password, unicode.IsSpace)
+	if username == "" {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// buildRequest assembles the NTRIP request for a mountpoint, or the
+// sourcetable when mountpoint is empty, in the given protocol version.
+// Custom headers come last and replace built-in ones of the same name.
+func (c *Client) buildRequest(mountpoint string, version int) string {
+	var request string
+	header := func(name, value string) {
+		if !c.overrides(name) {
+			request += fmt.Sprintf("%s: %s\r\n", name, value)
+		}
+	}
+	if version == NtripV2 {
+		request = fmt.Sprintf("GET /%s HTTP/1.1\r\n", mountpoint)
+		header("Host", c.host())
+		header("Ntrip-Version", "Ntrip/2.0")
+	} else {
+		request = fmt.Sprintf("GET /%s HTTP/1.0\r\n", mountpoint)
+	}
+	if auth := basicAuth(c.Username, c.Password); auth != "" {
+		header("Authorization", "Basic "+auth)
+	}
+	header("User-Agent", cmp.Or(c.UserAgent, defaultUserAgent()))
+	header("Connection", "close")
+	for _, h := range c.Headers {
+		request += fmt.Sprintf("%s: %s\r\n", h.Name, h.Value)
+	}
+	return request + "\r\n"
+}
+
+// address returns ServerAddr, adding the default port for plain or TLS
+// connections when none is given
+func (c *Client) address() string {
+	if _, ok := unixSocket(c.ServerAddr); ok {
+		return c.ServerAddr
+	}
+	if _, _, err := net.SplitHostPort(c.ServerAddr); err == nil {
+		return c.ServerAddr
+	}
+	port := defaultClientPort
+	if c.TLS {
+		port = defaultTLSPort
+	}
+	return net.JoinHostPort(strings.Trim(c.ServerAddr, "[]"), port)
+}
+
+// host returns the caster's host name for the request, localhost for a
+// UNIX socket
+func (c *Client) host() string {
+	if _, ok := unixSocket(c.ServerAddr); ok {
+		return "localhost"
+	}
+	return hostOnly(c.ServerAddr)
+}
+
+// hostOnly strips the port from a host:port address
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
-		return fmt.Errorf("failed to connect to server: %v", err)
+		return addr
+	}
+	return host
+}
+
+// parseResponse reads the status line and headers of a caster response.
+// Both the v1 "ICY 200 OK" and the v2 "HTTP/1.1 200 OK" forms are accepted,
+// as is "SOURCETABLE 200 OK". Sourcetable records describing the stream,
+// sent among the headers, in an Ntrip-STR header or in place of an ICY
+// status line ahead of the data, are collected in records.
+func parseResponse(r *bufio.Reader) (*ntripResponse, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if isRecord(line) {
+		resp := &ntripResponse{proto: "ICY", status: 200, header: make(map[string]string)}
+		resp.records.add(line)
+		return resp, resp.readHeaders(r)
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("unexpected short response from server: %q", line)
 	}
-	defer conn.Close()
 
-	// Create output file
-	file, err := os.Create(c.outputFile)
+	fields := strings.Fields(line)
+	if fields[0] != "ICY" && fields[0] != "SOURCETABLE" && !strings.HasPrefix(fields[0], "HTTP/") {
+		return nil, fmt.Errorf("invalid server response: %s", line)
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("unexpected short response from server: %q", line)
+	}
+	status, err := strconv.Atoi(fields[1])
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return nil, fmt.Errorf("invalid status code in response: %s", line)
+	}
+	resp := &ntripResponse{
+		proto:  fields[0],
+		status: status,
+		header: make(map[string]string),
 	}
-	defer file.Close()
 
-	// Send NTRIP request
-	request := fmt.Sprintf("GET /%s HTTP/1.0\r\n", c.mountpoint)
-	if c.username != "" && c.password != "" {
-		auth := fmt.Sprintf("%s:%s", c.username, c.password)
-		request += fmt.Sprintf("Authorization: Basic %s\r\n", auth)
+	if err := resp.readHeaders(r); err != nil {
+		return nil, err
 	}
-	request += "User-Agent: NTRIP Client\r\n"
-	request += "Connection: close\r\n\r\n"
+	return resp, nil
+}
 
-	_, err = conn.Write([]byte(request))
+// readHeaders reads the header block following the status line.
+//
+// ICY responses normally carry no header block and the stream follows
+// directly, but some casters still send headers, records or a blank line.
+// Skip them so they don't end up in the stream, stopping at the first
+// line that is not text. Casters join clients mid-stream, so the data may
+// start with any byte and carry no line ending at all.
+func (resp *ntripResponse) readHeaders(r *bufio.Reader) error {
+	for {
+		if resp.proto == "ICY" && !textLine(r) {
+			break
+		}
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("failed to read response headers: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unexpected short response from server: truncated headers")
+		}
+		if resp.records.add(line) {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "ntrip-str" && resp.records.add(value) {
+			continue
+		}
+		resp.header[name] = value
+	}
+	resp.chunked = strings.EqualFold(resp.header["transfer-encoding"], "chunked")
+	return nil
+}
+
+// maxHeaderLine bounds how far textLine looks for the end of a line
+const maxHeaderLine = 2048
+
+// textLine reports whether the next line in r, up to its newline, is
+// printable text starting like a header line or the blank line ending
+// the header block. It waits for the rest of a line split across
+// packets, but gives up at the first byte that is not text or after
+// maxHeaderLine bytes.
+func textLine(r *bufio.Reader) bool {
+	for n := 1; n <= min(maxHeaderLine, r.Size()); n++ {
+		peeked, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		b := peeked[n-1]
+		switch {
+		case n == 1 && !startsHeader(b):
+			return false
+		case b == '\n':
+			return true
+		case b != '\r' && b != '\t' && (b < ' ' || b > '~'):
+			return false
+		}
+	}
+	return false
+}
+
+// startsHeader reports whether b can begin a header line or the blank
+// line ending the header block
+func startsHeader(b byte) bool {
+	return b == '\r' || b == '\n' || ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z')
+}
+
+// v2Unsupported reports whether a status code returned to a v2 request
+// suggests the caster only speaks NTRIP v1
+func v2Unsupported(status int) bool {
+	return status == 400 || status == 405 || status == 505
+}
+
+// tlsConfig verifies the caster at addr unless TLSInsecure is set
+func (c *Client) tlsConfig(addr string) *tls.Config {
+	return &tls.Config{ServerName: hostOnly(addr), InsecureSkipVerify: c.TLSInsecure}
+}
+
+// startTLS runs the TLS handshake with the caster over a proxy tunnel
+func (c *Client) startTLS(ctx context.Context, conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	tc := tls.Client(conn, c.tlsConfig(addr))
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tc, nil
+}
+
+// handshake connects to the server, sends the request for mountpoint in
+// the given protocol version and parses the response
+func (c *Client) handshake(ctx context.Context, mountpoint string, version int) (net.Conn, *ntripResponse, error) {
+	addr := c.address()
+	timeout := c.ConnectTimeout
+	if timeout <= 0 {
+		timeout = dialTimeout
+	}
+	d := net.Dialer{Timeout: timeout, KeepAlive: c.TCPKeepalive}
+	var conn net.Conn
+	var err error
+	if path, ok := unixSocket(addr); ok {
+		if c.TLS {
+			return nil, nil, fmt.Errorf("TLS is not supported on a UNIX socket")
+		}
+		conn, err = d.DialContext(ctx, "unix", path)
+	} else if c.Proxy != "" {
+		conn, err = dialProxy(ctx, &d, c.Proxy, addr)
+		if err == nil && c.TLS {
+			conn, err = c.startTLS(ctx, conn, addr, timeout)
+		}
+	} else if c.TLS {
+		td := tls.Dialer{NetDialer: &d, Config: c.tlsConfig(addr)}
+		conn, err = td.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			return nil, nil, fmt.Errorf("%w %s after %v", ErrConnectTimeout, addr, timeout)
+		}
+		return nil, nil, fmt.Errorf("failed to connect to server: %v", err)
 	}
 
-	// Read and parse response
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+	tuneTCP(conn, c.TCPKeepalive)
+	_, err = conn.Write([]byte(c.buildRequest(mountpoint, version)))
 	if err != nil {
-		return fmt.Errorf("failed to read response: %v", err)
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to send request: %v", err)
 	}
 
-	response := string(buf[:n])
-	if response[:3] != "ICY" {
-		return fmt.Errorf("invalid server response: %s", response)
+	// Read and parse response, keeping any stream bytes that were
+	// buffered along with it. Cancelling ctx cuts the wait short.
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	cancelled := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	br := bufio.NewReader(conn)
+	resp, err := parseResponse(br)
+	if !cancelled() {
+		conn.Close()
+		return nil, nil, ctx.Err()
 	}
+	if err != nil {
+		conn.Close()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, nil, fmt.Errorf("%w from %s after %v", ErrHeaderTimeout, addr, timeout)
+		}
+		return nil, nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, r: br}, resp, nil
+}
 
-	log.Printf("Connected to NTRIP server, receiving RTCM data...")
+// stream is the RTCM body of a caster response, with any chunked framing
+// removed
+type stream struct {
+	io.Reader
+	conn net.Conn
+	stop func() bool
+}
+
+// Close stops watching the context and closes the connection
+func (st *stream) Close() error {
+	st.stop()
+	return st.conn.Close()
+}
 
-	// Create a buffer for RTCM data
-	rtcmBuffer := make([]byte, 1024)
-	rtcmFile, err := os.Create(c.outputFile)
+// open connects to the caster, falling back to NTRIP v1 when a v2 request
+// is refused, and returns the stream once the caster accepts the request.
+// Cancelling ctx closes the stream.
+func (c *Client) open(ctx context.Context) (*stream, error) {
+	st, resp, err := c.request(ctx, c.Mountpoint)
 	if err != nil {
-		return fmt.Errorf("failed to create RTCM file: %v", err)
+		return nil, err
+	}
+	if isSourceTable(resp) {
+		st.Close()
+		return nil, fmt.Errorf("mountpoint %q not found, the caster returned its sourcetable", c.Mountpoint)
 	}
-	defer rtcmFile.Close()
+	logRecords(resp.records)
+	return st, nil
+}
 
-	// Read and save RTCM data
+// logRecords logs the stream and caster metadata a caster sent with its
+// response
+func logRecords(t SourceTable) {
+	for _, si := range t.Streams {
+		slog.Info("Caster describes the stream", "mountpoint", si.Mountpoint, "identifier", si.Identifier,
+			"format", strings.TrimSpace(si.Format+" "+si.FormatDetails), "nav_system", si.NavSystem,
+			"country", si.Country, "latitude", si.Latitude, "longitude", si.Longitude, "bitrate", si.Bitrate)
+	}
+	for _, ci := range t.Casters {
+		slog.Info("Caster info", "host", ci.Host, "port", ci.Port, "identifier", ci.Identifier,
+			"operator", ci.Operator, "country", ci.Country, "fallback", net.JoinHostPort(ci.FallbackHost, strconv.Itoa(ci.FallbackPort)))
+	}
+	for _, ni := range t.Networks {
+		slog.Info("Caster network", "identifier", ni.Identifier, "operator", ni.Operator)
+	}
+}
+
+// request connects to the caster and requests path, falling back to NTRIP
+// v1 when a v2 request is refused, and returns the response body once the
+// caster accepts the request. Cancelling ctx closes the body.
+func (c *Client) request(ctx context.Context, path string) (*stream, *ntripResponse, error) {
+	conn, resp, err := c.handshake(ctx, path, c.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Version == NtripV2 && v2Unsupported(resp.status) {
+		slog.Warn("Server refused NTRIP v2 request, falling back to v1", "status", resp.status)
+		conn.Close()
+		conn, resp, err = c.handshake(ctx, path, NtripV1)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if resp.status != 200 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("server rejected request: %s %d", resp.proto, resp.status)
+	}
+
+	// NTRIP v2 casters frame the stream with chunked transfer encoding,
+	// strip it so only RTCM bytes are read
+	st := &stream{Reader: conn, conn: conn}
+	if resp.chunked {
+		st.Reader = httputil.NewChunkedReader(conn)
+	}
+	// Unblock readers when the context is cancelled
+	st.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	return st, resp, nil
+}
+
+// isSourceTable reports whether a response carries the sourcetable rather
+// than a stream, as casters answer requests for unknown mountpoints
+func isSourceTable(resp *ntripResponse) bool {
+	return resp.proto == "SOURCETABLE" || strings.HasPrefix(resp.header["content-type"], "gnss/sourcetable")
+}
+
+// SourceTable requests the caster's sourcetable and parses it
+func (c *Client) SourceTable(ctx context.Context) (*SourceTable, error) {
+	body, resp, err := c.request(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	// Some casters answer with a plain HTTP 200 and no content type, but
+	// an ICY response is a stream
+	if resp.proto == "ICY" {
+		return nil, fmt.Errorf("server returned a stream instead of its sourcetable")
+	}
+	return ParseSourceTable(body)
+}
+
+// Stream connects to the caster and returns its RTCM stream for the
+// caller to read, without writing anything to OutputFile. The handshake,
+// v1 fallback and v2 chunked framing are handled internally, and an error
+// is returned if the caster refuses the request. Reads fail once the
+// connection drops or ctx is cancelled.
+func (c *Client) Stream(ctx context.Context) (io.ReadCloser, error) {
+	return c.open(ctx)
+}
+
+// Check connects to the caster and waits for the first valid RTCM frame,
+// verifying the address, mountpoint and credentials without writing any
+// output. The GGA sentence is sent first when set. Check fails if ctx
+// expires before a frame arrives.
+func (c *Client) Check(ctx context.Context) (rtcm.Message, error) {
+	body, err := c.open(ctx)
+	if err != nil {
+		return rtcm.Message{}, err
+	}
+	defer body.Close()
+
+	if c.sendsGGA() {
+		if err := c.sendGGA(body.conn); err != nil {
+			return rtcm.Message{}, err
+		}
+	}
+
+	framer := rtcm.NewFramer()
+	buf := make([]byte, 1024)
 	for {
-		n, err := conn.Read(rtcmBuffer)
+		n, err := body.Read(buf)
+		if msgs := framer.Feed(buf[:n]); len(msgs) > 0 {
+			return msgs[0], nil
+		}
 		if err != nil {
-			if err == io.EOF {
-				log.Println("Connection closed by server")
-				break
+			if ctx.Err() != nil {
+				return rtcm.Message{}, fmt.Errorf("no RTCM frame received: %v", ctx.Err())
 			}
-			return fmt.Errorf("error reading RTCM data: %v", err)
+			return rtcm.Message{}, fmt.Errorf("no RTCM frame received: %v", err)
 		}
+	}
+}
+
+// sniffBytes and sniffTimeout bound how much of the stream SniffRTCM
+// reads, and for how long, looking for an RTCM 3 frame
+const (
+	sniffBytes   = 4096
+	sniffTimeout = 10 * time.Second
+)
+
+// ErrNotRTCM is returned by Run and Connect with RequireRTCM when the
+// stream does not start with valid RTCM 3 frames
+var ErrNotRTCM = errors.New("stream is not RTCM 3")
 
-		// Write RTCM data to file
-		_, err = rtcmFile.Write(rtcmBuffer[:n])
+// sniff reads the start of the stream until it holds a valid RTCM 3
+// frame, or sniffBytes or sniffTimeout have gone by without one, and
+// returns what it read. A stream without a frame is warned about, or
+// fails with ErrNotRTCM under RequireRTCM.
+func (c *Client) sniff(body *stream) ([]byte, error) {
+	body.conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	defer body.conn.SetReadDeadline(time.Time{})
+
+	framer := rtcm.NewFramer()
+	var sniffed []byte
+	buf := make([]byte, 1024)
+	for len(sniffed) < sniffBytes {
+		n, err := body.Read(buf)
+		sniffed = append(sniffed, buf[:n]...)
+		if len(framer.Feed(buf[:n])) > 0 {
+			slog.Debug("Stream carries RTCM 3", "sniffed", len(sniffed))
+			return sniffed, nil
+		}
 		if err != nil {
-			return fmt.Errorf("error writing RTCM data to file: %v", err)
+			break
 		}
+	}
+	// Nothing arrived at all, the read loop reports why
+	if len(sniffed) == 0 {
+		return nil, nil
+	}
 
-		// Output RTCM data to stdout for web interface
-		fmt.Println("RTCM chunk received")
-		os.Stdout.Write(rtcmBuffer[:n])
+	start := sniffed[:min(len(sniffed), 64)]
+	if c.RequireRTCM {
+		return nil, fmt.Errorf("%w: no valid frame in the first %d bytes, starting %q", ErrNotRTCM, len(sniffed), start)
+	}
+	slog.Warn("Stream does not look like RTCM 3, check the mountpoint", "bytes", len(sniffed), "start", string(start))
+	return sniffed, nil
+}
 
-		// Log the data size for monitoring
-		log.Printf("Received %d bytes of RTCM data", n)
+// nextOutput starts a new timestamped output file for the next connection
+func (c *Client) nextOutput() {
+	c.OutputFile = c.TimestampedName()
+	if c.OutputFile != "" {
+		slog.Info("Output file", "file", c.OutputFile)
 	}
+}
+
+// sendsGGA reports whether the client uploads a position
+func (c *Client) sendsGGA() bool {
+	return c.GGA != "" || c.GGAFile != ""
+}
 
+// sendGGA writes the current GGA sentence to the caster
+func (c *Client) sendGGA(conn net.Conn) error {
+	var sentence string
+	var err error
+	if c.GGAFile != "" {
+		sentence, err = ReadGGAFile(c.GGAFile)
+		if err != nil {
+			slog.Warn("Skipping GGA", "err", err)
+			return nil
+		}
+	} else {
+		sentence, err = GGASentence(c.GGA, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write([]byte(sentence + "\r\n")); err != nil {
+		return fmt.Errorf("failed to send GGA: %v", err)
+	}
 	return nil
 }
 
-func main() {
-	serverAddr := flag.String("server", "localhost:2101", "NTRIP server address")
-	mountpoint := flag.String("mountpoint", "RTCM3", "NTRIP mountpoint")
-	username := flag.String("username", "", "NTRIP username")
-	password := flag.String("password", "", "NTRIP password")
-	outputFile := flag.String("output", "rtcm_data.bin", "Output file for RTCM data")
-	flag.Parse()
+// repeatGGA re-sends the GGA sentence every ggaInterval until done is closed
+func (c *Client) repeatGGA(conn net.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(c.GGAInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.sendGGA(conn); err != nil {
+				slog.Error("Failed to send GGA", "err", err)
+				return
+			}
+		}
+	}
+}
 
-	client := NewNtripClient(*serverAddr, *mountpoint, *username, *password, *outputFile)
+// TimestampedName returns the output file name for a capture started now:
+// the output file with the time appended, or NameTemplate expanded, in
+// OutputDir. In the template {mount}, {host} and {output} stand for the
+// mountpoint, the caster's host and the output file, and the rest is a Go
+// time layout, so "{mount}/2006-01-02.bin" writes a file a day per
+// mountpoint.
+func (c *Client) TimestampedName() string {
+	base := c.base()
+	if base == "" {
+		return ""
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s_%s", base, now.Format("20060102_150405"))
+	if c.NameTemplate != "" {
+		name = c.expandName(c.NameTemplate, now)
+	}
+	return filepath.Join(c.OutputDir, name)
+}
 
-	// Add timestamp to output filename
-	timestamp := time.Now().Format("20060102_150405")
-	client.outputFile = fmt.Sprintf("%s_%s", *outputFile, timestamp)
+// base returns the output file the timestamped names derive from. A
+// client not made by NewClient takes OutputFile as it is the first time.
+func (c *Client) base() string {
+	if c.outputBase == "" {
+		c.outputBase = c.OutputFile
+	}
+	return c.outputBase
+}
 
-	log.Printf("Starting NTRIP client...")
-	log.Printf("Connecting to %s, mountpoint: %s", *serverAddr, *mountpoint)
-	log.Printf("Output file: %s", client.outputFile)
+// Run connects to the caster and, when retrying is enabled, reconnects
+// with exponential backoff each time the stream ends. With failover
+// endpoints each reconnect moves on to the next one, backing off only once
+// all have been tried. Every reconnect starts a new timestamped output
+// file. Run returns nil once ctx is done.
+func (c *Client) Run(ctx context.Context) error {
+	defer c.closeMessages()
+	defer c.finishSidecar()
+	if !c.Retry && len(c.Failover) == 0 {
+		return c.connect(ctx)
+	}
 
-	if err := client.Connect(); err != nil {
-		log.Fatalf("Error: %v", err)
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = time.Second
 	}
-} 
\ No newline at end of file
+	endpoints := append([]Endpoint{c.endpoint()}, c.Failover...)
+	current := 0
+	interval := c.RetryInterval
+	retries := 0
+	for {
+		c.use(endpoints[current])
+		if len(endpoints) > 1 {
+			slog.Info("Using caster", "endpoint", endpoints[current].String(), "primary", current == 0)
+		}
+		// A backup is only kept until the cooldown is over
+		connCtx, cancel := ctx, context.CancelFunc(func() {})
+		if current > 0 && c.FailoverCooldown > 0 {
+			connCtx, cancel = context.WithTimeout(ctx, c.FailoverCooldown)
+		}
+
+		started := time.Now()
+		err := c.connect(connCtx)
+		cooledDown := connCtx.Err() != nil
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrDiskGuard) || errors.Is(err, ErrNotRTCM) {
+			return err
+		}
+		if cooledDown {
+			slog.Info("Failover cooldown over, returning to the primary caster", "endpoint", endpoints[0].String())
+			current = 0
+			c.nextOutput()
+			continue
+		}
+		if err != nil {
+			slog.Error("Connection failed", "endpoint", endpoints[current].String(), "err", err)
+		}
+
+		// A connection that streamed for a while counts as healthy
+		if time.Since(started) >= stablePeriod {
+			interval = c.RetryInterval
+			retries = 0
+		}
+		if c.MaxRetries > 0 && retries >= c.MaxRetries {
+			return fmt.Errorf("giving up after %d retries: %v", retries, err)
+		}
+		retries++
+
+		// Back off once every endpoint has failed in turn
+		current = (current + 1) % len(endpoints)
+		if current == 0 {
+			slog.Info("Reconnecting", "delay", interval, "attempt", retries)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+			interval = min(interval*2, maxRetryInterval)
+		}
+
+		c.nextOutput()
+	}
+}
+
+// Connect streams from the caster until the connection ends or ctx is done
+func (c *Client) Connect(ctx context.Context) error {
+	defer c.closeMessages()
+	defer c.finishSidecar()
+	return c.connect(ctx)
+}
+
+// connect makes a single connection for Connect and Run
+func (c *Client) connect(ctx context.Context) error {
+	// Connect to the NTRIP server
+	body, err := c.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	conn := body.conn
+	c.noteConnected()
+	defer c.noteDisconnected()
+
+	slog.Info("Connected to NTRIP server, receiving RTCM data", "server", c.ServerAddr, "mountpoint", c.Mountpoint)
+
+	// Upload the rover position for network RTK casters
+	if c.sendsGGA() {
+		if err := c.sendGGA(conn); err != nil {
+			return err
+		}
+		if c.GGAInterval > 0 {
+			done := make(chan struct{})
+			defer close(done)
+			go c.repeatGGA(conn, done)
+		}
+	}
+
+	// Make sure the caster sends RTCM before capturing anything, replaying
+	// the sniffed bytes to the outputs afterwards
+	var stream io.Reader = body
+	if c.SniffRTCM || c.RequireRTCM {
+		sniffed, err := c.sniff(body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		stream = io.MultiReader(bytes.NewReader(sniffed), body)
+	}
+
+	// Open the output file, continuing it if it already exists. Without
+	// an output file the stream only goes to the other outputs.
+	readSize := c.ReadBufferSize
+	if readSize <= 0 {
+		readSize = defaultReadBufferSize
+	}
+	rtcmBuffer := make([]byte, readSize)
+	var rtcmFile io.Writer = io.Discard
+	if c.OutputFile != "" && !c.guarded {
+		f, err := c.openOutput()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rtcmFile = f
+		if c.Timestamped {
+			rtcmFile = &recordWriter{w: f}
+		}
+	}
+	framer := rtcm.NewFramer()
+
+	// Read and save RTCM data
+	for {
+		if c.DataTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(c.DataTimeout))
+		}
+		n, err := stream.Read(rtcmBuffer)
+		received := time.Now()
+
+		// A read can return the last bytes of the stream together with
+		// its error, so handle them before the error
+		if n > 0 {
+			// Write RTCM data to file
+			if _, err := rtcmFile.Write(rtcmBuffer[:n]); err != nil {
+				return fmt.Errorf("error writing RTCM data to file: %w", err)
+			}
+
+			msgs := c.inspect(framer, rtcmBuffer[:n])
+			if err := c.deliver(ctx, msgs, received); err != nil {
+				return nil
+			}
+			c.updateSidecar()
+
+			if c.Data != nil {
+				select {
+				case c.Data <- append([]byte(nil), rtcmBuffer[:n]...):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+			if c.Stdout != nil {
+				if _, err := c.Stdout.Write(rtcmBuffer[:n]); err != nil {
+					return fmt.Errorf("error writing RTCM data to stdout: %v", err)
+				}
+			}
+			if c.Serial != nil {
+				if _, err := c.Serial.Write(rtcmBuffer[:n]); err != nil {
+					return fmt.Errorf("error writing RTCM data to serial port: %v", err)
+				}
+			}
+			if c.Command != nil {
+				if _, err := c.Command.Write(rtcmBuffer[:n]); err != nil {
+					return fmt.Errorf("error writing RTCM data to command: %v", err)
+				}
+			}
+
+			// Log the data size for monitoring
+			slog.Debug("Received RTCM data", "bytes", n)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no data received for %v", c.DataTimeout)
+			}
+			if err == io.EOF {
+				slog.Info("Connection closed by server")
+				break
+			}
+			return fmt.Errorf("error reading RTCM data: %v", err)
+		}
+	}
+
+	return nil
+}
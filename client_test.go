@@ -0,0 +1,246 @@
+package ntrip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCaster answers every connection with response, written in one call
+// once the request headers have been read, and returns its address
+func fakeCaster(t *testing.T, response []byte) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == "\r\n" {
+						break
+					}
+				}
+				conn.Write(response)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// readStream reads the whole stream of the caster at addr
+func readStream(t *testing.T, addr string, version int) []byte {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := NewClient(addr, "RTCM3", "", "", "")
+	c.Version = version
+	stream, err := c.Stream(ctx)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	return data
+}
+
+func TestStreamDecoding(t *testing.T) {
+	payload := []byte("\xd3\x00\x13\x3e\xd0\x2a\x00\x08\xb9\x02\x15\xe0\x01\x89\x48\xff\xf0\x0b\xe4\x74\x09\x10\x4c\xff\xe0")
+	tests := []struct {
+		name     string
+		version  int
+		response string
+	}{
+		{
+			name:     "v1 passed through",
+			version:  NtripV1,
+			response: "ICY 200 OK\r\n" + string(payload),
+		},
+		{
+			name:    "v2 chunked",
+			version: NtripV2,
+			response: "HTTP/1.1 200 OK\r\nContent-Type: gnss/data\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"3\r\n" + string(payload[:3]) + "\r\n" +
+				"10\r\n" + string(payload[3:19]) + "\r\n" +
+				"6\r\n" + string(payload[19:]) + "\r\n" +
+				"0\r\n\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeCaster(t, []byte(tt.response))
+			if got := readStream(t, addr, tt.version); !bytes.Equal(got, payload) {
+				t.Errorf("stream = %x, want %x", got, payload)
+			}
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		err      string // Expected error, empty when the response is valid
+		proto    string
+		status   int
+	}{
+		{name: "zero bytes", response: "", err: "unexpected short response"},
+		{name: "one byte", response: "I", err: "unexpected short response"},
+		{name: "truncated status", response: "ICY", err: "unexpected short response"},
+		{name: "truncated status line", response: "HTTP/1.1", err: "unexpected short response"},
+		{name: "truncated headers", response: "HTTP/1.1 200 OK\r\nContent-Type: gn", err: "truncated headers"},
+		{name: "not ntrip", response: "SSH-2.0-OpenSSH\r\n", err: "invalid server response"},
+		{name: "invalid status", response: "ICY OK\r\n", err: "invalid status code"},
+		{name: "icy", response: "ICY 200 OK\r\n", proto: "ICY", status: 200},
+		{name: "icy without line end", response: "ICY 200 OK", proto: "ICY", status: 200},
+		{name: "v2", response: "HTTP/1.1 200 OK\r\nNtrip-Version: Ntrip/2.0\r\n\r\n", proto: "HTTP/1.1", status: 200},
+		{name: "unauthorized", response: "HTTP/1.1 401 Unauthorized\r\n\r\n", proto: "HTTP/1.1", status: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := parseResponse(bufio.NewReader(strings.NewReader(tt.response)))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.proto != tt.proto || resp.status != tt.status {
+				t.Errorf("got %s %d, want %s %d", resp.proto, resp.status, tt.proto, tt.status)
+			}
+		})
+	}
+}
+
+func TestShortResponseFromCaster(t *testing.T) {
+	for _, response := range []string{"", "I", "IC"} {
+		addr := fakeCaster(t, []byte(response))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := NewClient(addr, "RTCM3", "", "", "").Stream(ctx)
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), "unexpected short response") {
+			t.Errorf("response %q: error = %v, want an unexpected short response", response, err)
+		}
+	}
+}
+
+// TestConnectWholeResponseInOnePacket has the caster send the headers,
+// the body and the end of the stream in a single write, so that the last
+// read returns data together with the end of the stream
+func TestConnectWholeResponseInOnePacket(t *testing.T) {
+	payload := []byte("\xd3\x00\x13\x3e\xd0\x2a\x00\x08\xb9\x02\x15\xe0\x01\x89\x48\xff\xf0\x0b\xe4\x74\x09\x10\x4c\xff\xe0")
+	tests := []struct {
+		name     string
+		version  int
+		response string
+	}{
+		{"v1", NtripV1, "ICY 200 OK\r\n" + string(payload)},
+		{"v2", NtripV2, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n19\r\n" + string(payload) + "\r\n0\r\n\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var out bytes.Buffer
+			c := NewClient(fakeCaster(t, []byte(tt.response)), "RTCM3", "", "", "")
+			c.Version = tt.version
+			c.Stdout = &out
+			if err := c.Connect(ctx); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), payload) {
+				t.Errorf("output = %x, want %x", out.Bytes(), payload)
+			}
+		})
+	}
+}
+
+// TestICYHeaderAndBodyInOnePacket parses ICY responses whose headers and
+// first stream bytes arrive in a single packet, as some casters send them
+func TestICYHeaderAndBodyInOnePacket(t *testing.T) {
+	body := []byte("\xd3\x00\x13\x3e\xd0\x2a\x00\x08\xb9\x02\x15\xe0\x01\x89\x48\xff\xf0\x0b\xe4\x74\x09\x10\x4c\xff\xe0")
+	tests := map[string]string{
+		"status line only": "ICY 200 OK\r\n",
+		"blank line":       "ICY 200 OK\r\n\r\n",
+		"headers":          "ICY 200 OK\r\nServer: NTRIP Caster\r\nContent-Type: gnss/data\r\n\r\n",
+	}
+	for name, header := range tests {
+		t.Run(name, func(t *testing.T) {
+			packet := append([]byte(header), body...)
+			r := bufio.NewReader(bytes.NewReader(packet))
+			resp, err := parseResponse(r)
+			if err != nil {
+				t.Fatalf("parseResponse: %v", err)
+			}
+			if resp.proto != "ICY" || resp.status != 200 {
+				t.Errorf("got %s %d, want ICY 200", resp.proto, resp.status)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, body) {
+				t.Errorf("stream = %x, %v, want %x", got, err, body)
+			}
+		})
+	}
+}
+
+// TestReconnectStructLiteral reconnects a client built without NewClient
+// and checks each connection is captured to a file of its own
+func TestReconnectStructLiteral(t *testing.T) {
+	payload := []byte("\xd3\x00\x13\x3e\xd0\x2a\x00\x08\xb9\x02\x15\xe0\x01\x89\x48\xff\xf0\x0b\xe4\x74\x09\x10\x4c\xff\xe0")
+	output := filepath.Join(t.TempDir(), "capture")
+	c := &Client{
+		ServerAddr:    fakeCaster(t, append([]byte("ICY 200 OK\r\n"), payload...)),
+		Mountpoint:    "RTCM3",
+		OutputFile:    output,
+		Version:       NtripV1,
+		Retry:         true,
+		RetryInterval: 10 * time.Millisecond,
+		MaxRetries:    2,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Run(ctx); err == nil || !strings.Contains(err.Error(), "giving up") {
+		t.Fatalf("Run = %v, want it to give up after its retries", err)
+	}
+
+	if got, err := os.ReadFile(output); err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("first capture = %x, %v, want %x", got, err, payload)
+	}
+	reconnects, err := filepath.Glob(output + "_*")
+	if err != nil || len(reconnects) == 0 {
+		t.Fatalf("no capture after reconnecting, OutputFile = %q", c.OutputFile)
+	}
+	var captured []byte
+	for _, name := range reconnects {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		captured = append(captured, data...)
+	}
+	if !bytes.Equal(captured, bytes.Repeat(payload, 2)) {
+		t.Errorf("reconnects captured %d bytes, want the stream twice", len(captured))
+	}
+}
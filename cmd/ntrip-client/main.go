@@ -0,0 +1,323 @@
+// Command ntrip-client captures the RTCM stream of a mountpoint to a file.
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"ntrip"
+)
+
+// defaultGGAFileInterval is how often -gga-file is re-read and sent when
+// -gga-interval is not given
+const defaultGGAFileInterval = 10 * time.Second
+
+func main() {
+	serverAddr := flag.String("server", "localhost", "NTRIP server address, the port defaults to 2101, or 2102 with -tls")
+	mountpoint := flag.String("mountpoint", "RTCM3", "NTRIP mountpoint")
+	username := flag.String("username", "", "NTRIP username")
+	password := flag.String("password", "", "NTRIP password")
+	outputFile := flag.String("output", "rtcm_data.bin", "Output file for RTCM data, empty to write no file")
+	outputDir := flag.String("output-dir", "", "Directory to write output files in, created if missing")
+	nameTemplate := flag.String("name-template", "", "Output file name as a Go time layout with {mount}, {host} and {output} placeholders, e.g. {mount}/2006-01-02.bin (default: output_20060102_150405)")
+	ntripVersion := flag.Int("ntrip-version", ntrip.NtripV1, "NTRIP protocol version (1 or 2)")
+	gga := flag.String("gga", "", "GGA sentence, or lat,lon[,alt] in decimal degrees, to send to the caster")
+	ggaInterval := flag.Duration("gga-interval", 0, "Interval for re-sending the GGA sentence (0 sends it once, or every 10s with -gga-file)")
+	ggaFile := flag.String("gga-file", "", "File another process keeps the rover's latest GGA sentence in, re-read on every send")
+	retry := flag.Bool("retry", false, "Reconnect when the connection is lost")
+	retryInterval := flag.Duration("retry-interval", time.Second, "Initial delay between reconnect attempts, doubled on each failure")
+	failover := flag.String("failover", "", "Comma-separated backup casters as server[:port]/mountpoint[/user:pass], tried in turn when the connection is lost (implies -retry)")
+	failoverCooldown := flag.Duration("failover-cooldown", 5*time.Minute, "Return to the primary caster after this long on a backup (0 stays on the backup)")
+	dataTimeout := flag.Duration("data-timeout", 0, "Treat the connection as lost when no data arrives for this long (0 disables)")
+	maxRetries := flag.Int("max-retries", 0, "Give up after this many consecutive reconnect attempts (0 retries forever)")
+	maxTotalBytes := flag.Int64("max-total-bytes", 0, "Stop writing the output once the files of this run would exceed this many bytes (0 disables)")
+	minFreeBytes := flag.Int64("min-free-bytes", 0, "Stop writing the output when the volume would have less than this many bytes free (0 disables)")
+	prune := flag.Bool("prune", false, "Delete the oldest rotated files of this run to stay within -max-total-bytes and -min-free-bytes")
+	diskGuardExit := flag.Bool("disk-guard-exit", false, "Exit with an error when a disk limit is reached instead of only stopping the file")
+	rotateSize := flag.Int64("rotate-size", 0, "Start a new output file after this many bytes (0 disables)")
+	rotateInterval := flag.Duration("rotate-interval", 0, "Start a new output file after this long (0 disables)")
+	compress := flag.Bool("gzip", false, "Gzip output files once they are rotated out")
+	flushInterval := flag.Duration("flush-interval", 0, "Buffer file writes and flush them this often, e.g. 5s to spare SD cards (0 writes through)")
+	timestamped := flag.Bool("timestamped", false, "Write the file as timestamped records of each chunk received instead of the raw stream")
+	stdout := flag.Bool("stdout", false, "Also write the raw RTCM stream to stdout")
+	serialOut := flag.String("serial-out", "", "Also write the raw RTCM stream to this serial port, e.g. a rover's correction input")
+	userAgent := flag.String("user-agent", "", "User-Agent sent to the caster (default \"NTRIP/"+ntrip.Version+"\")")
+	var headers []string
+	flag.Func("header", "Extra request header \"Name: value\", repeatable", func(s string) error {
+		headers = append(headers, s)
+		return nil
+	})
+	allowReserved := flag.Bool("allow-reserved-headers", false, "Let -header replace headers the client sets itself, such as Authorization")
+	execCommand := flag.String("exec", "", "Also write the raw RTCM stream to the stdin of this shell command, restarting it if it exits")
+	serialBaud := flag.Int("serial-baud", 115200, "Baud rate of the -serial-out port")
+	serialDataBits := flag.Int("serial-data-bits", 8, "Data bits of the -serial-out port")
+	serialStopBits := flag.Int("serial-stop-bits", 1, "Stop bits of the -serial-out port")
+	serialParity := flag.String("serial-parity", "N", "Parity of the -serial-out port: N, E or O")
+	useTLS := flag.Bool("tls", false, "Connect to the caster over TLS")
+	tlsInsecure := flag.Bool("tls-insecure", false, "Skip verifying the caster's TLS certificate")
+	readBufferSize := flag.Int("read-buffer-size", 4096, "Bytes read from the caster at once")
+	proxy := flag.String("proxy", "", "Proxy to reach the caster through, http://[user:pass@]host:port (CONNECT) or socks5://... (default from HTTPS_PROXY, HTTP_PROXY or ALL_PROXY; \"direct\" ignores them)")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "Give up connecting to the caster, or waiting for its response, after this long")
+	tcpKeepalive := flag.Duration("tcp-keepalive", 0, "TCP keepalive period of the caster connection, 0 for the default of 15s, negative disables")
+	list := flag.Bool("list", false, "Print the caster's mountpoints from its sourcetable and exit")
+	check := flag.Bool("check", false, "Only verify that the mountpoint streams RTCM, without writing any output, and exit 0 on success")
+	rateInterval := flag.Duration("rate-interval", 0, "Log the stream bitrate, averaged over about 10s, this often (0 disables)")
+	sniff := flag.Bool("sniff", false, "Warn when the start of the stream holds no valid RTCM 3 frame, as for a mistyped mountpoint")
+	requireRTCM := flag.Bool("require-rtcm", false, "Exit with an error instead of capturing when the start of the stream holds no valid RTCM 3 frame")
+	continuity := flag.Bool("continuity", false, "Warn about gaps in the epochs of MSM and 1004/1012 observation messages")
+	sidecar := flag.Bool("sidecar", false, "Write <output>.json describing the capture: caster, times, bytes, message counts, connections and gaps")
+	sidecarInterval := flag.Duration("sidecar-interval", time.Minute, "How often the sidecar is rewritten during the capture")
+	checkTimeout := flag.Duration("check-timeout", 10*time.Second, "How long -check waits for the first RTCM frame")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	flag.Parse()
+
+	if err := ntrip.SetupLogging(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Invalid logging flags: %v", err)
+	}
+
+	if *ntripVersion != ntrip.NtripV1 && *ntripVersion != ntrip.NtripV2 {
+		log.Fatalf("Invalid NTRIP version: %d", *ntripVersion)
+	}
+
+	client := ntrip.NewClient(*serverAddr, *mountpoint, *username, *password, *outputFile)
+	client.Version = *ntripVersion
+	client.TLS = *useTLS || *tlsInsecure
+	client.TLSInsecure = *tlsInsecure
+	switch *proxy {
+	case "direct":
+	case "":
+		client.Proxy = ntrip.ProxyFromEnvironment(*serverAddr, client.TLS)
+	default:
+		client.Proxy = *proxy
+	}
+	client.ConnectTimeout = *connectTimeout
+	client.TCPKeepalive = *tcpKeepalive
+	client.ReadBufferSize = *readBufferSize
+	client.UserAgent = *userAgent
+	for _, s := range headers {
+		h, err := ntrip.ParseHeader(s, *allowReserved)
+		if err != nil {
+			log.Fatalf("Invalid -header: %v", err)
+		}
+		client.Headers = append(client.Headers, h)
+	}
+	if *gga != "" && *ggaFile != "" {
+		log.Fatalf("-gga and -gga-file are mutually exclusive")
+	}
+	if *gga != "" {
+		if _, err := ntrip.GGASentence(*gga, time.Now()); err != nil {
+			log.Fatalf("Invalid -gga value: %v", err)
+		}
+		client.GGA = *gga
+		client.GGAInterval = *ggaInterval
+	}
+	if *ggaFile != "" {
+		client.GGAFile = *ggaFile
+		client.GGAInterval = cmp.Or(*ggaInterval, defaultGGAFileInterval)
+	}
+
+	if *list {
+		os.Exit(runList(client))
+	}
+	if *check {
+		os.Exit(runCheck(client, *checkTimeout))
+	}
+
+	if *failover != "" {
+		endpoints, err := ntrip.ParseEndpoints(*failover)
+		if err != nil {
+			log.Fatalf("Invalid -failover: %v", err)
+		}
+		client.Failover = endpoints
+		client.FailoverCooldown = *failoverCooldown
+	}
+	client.DataTimeout = *dataTimeout
+
+	client.Retry = *retry
+	client.RetryInterval = *retryInterval
+	client.MaxRetries = *maxRetries
+	client.RotateSize = *rotateSize
+	client.MaxTotalBytes = *maxTotalBytes
+	client.MinFreeBytes = *minFreeBytes
+	client.PruneOutput = *prune
+	client.ExitOnDiskGuard = *diskGuardExit
+	client.RotateInterval = *rotateInterval
+	client.Compress = *compress
+	client.FlushInterval = *flushInterval
+	client.Timestamped = *timestamped
+	client.OutputDir = *outputDir
+	client.NameTemplate = *nameTemplate
+	client.CheckContinuity = *continuity
+	client.Sidecar = *sidecar
+	client.SidecarInterval = *sidecarInterval
+	client.SniffRTCM = *sniff
+	client.RequireRTCM = *requireRTCM
+	if *stdout {
+		client.Stdout = os.Stdout
+	}
+	// Closed before exiting, os.Exit skips deferred calls
+	var outputs []io.Closer
+	if *serialOut != "" {
+		sp, err := ntrip.OpenSerialPort(ntrip.SerialConfig{
+			Port:     *serialOut,
+			BaudRate: *serialBaud,
+			DataBits: *serialDataBits,
+			StopBits: *serialStopBits,
+			Parity:   *serialParity,
+		})
+		if err != nil {
+			log.Fatalf("Invalid -serial-out: %v", err)
+		}
+		outputs = append(outputs, sp)
+		client.Serial = sp
+		slog.Info("Writing RTCM data to serial port", "port", *serialOut, "baud", *serialBaud)
+	}
+	if *execCommand != "" {
+		cw := ntrip.NewCommandWriter(*execCommand)
+		outputs = append(outputs, cw)
+		client.Command = cw
+	}
+
+	code := runClient(client, *rateInterval)
+	for _, output := range outputs {
+		output.Close()
+	}
+	os.Exit(code)
+}
+
+// runClient captures the stream until the client gives up or is stopped,
+// returning the exit code
+func runClient(client *ntrip.Client, rateInterval time.Duration) int {
+	// Add timestamp to output filename
+	client.OutputFile = client.TimestampedName()
+
+	slog.Info("Starting NTRIP client", "server", client.ServerAddr, "mountpoint", client.Mountpoint, "file", client.OutputFile, "version", ntrip.Version)
+
+	// Stop cleanly on SIGINT/SIGTERM, including while waiting to retry,
+	// closing the output file before exiting. A second signal exits
+	// immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	// Print the message counts on SIGUSR1 and once the client exits
+	usr1 := make(chan os.Signal, 1)
+	notifyCounts(usr1)
+	go func() {
+		for range usr1 {
+			slog.Info("Stream bitrate", "bps", client.Bitrate())
+			logCounts(client)
+		}
+	}()
+	if rateInterval > 0 {
+		go logBitrate(ctx, client, rateInterval)
+	}
+
+	started := time.Now()
+	err := client.Run(ctx)
+	logSummary(client, time.Since(started))
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// runList prints the mountpoints in the caster's sourcetable, returning
+// the exit code
+func runList(client *ntrip.Client) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	table, err := client.SourceTable(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get sourcetable: %v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MOUNTPOINT\tIDENTIFIER\tFORMAT\tNAV SYSTEM\tCOUNTRY\tLATITUDE\tLONGITUDE\tAUTH")
+	for _, si := range table.Streams {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f\t%.2f\t%s\n", si.Mountpoint, si.Identifier,
+			strings.TrimSpace(si.Format+" "+si.FormatDetails), si.NavSystem, si.Country, si.Latitude, si.Longitude, si.Authentication)
+	}
+	w.Flush()
+	for _, ci := range table.Casters {
+		fmt.Printf("Caster %s:%d %s (%s)\n", ci.Host, ci.Port, ci.Identifier, ci.Operator)
+	}
+	for _, ni := range table.Networks {
+		fmt.Printf("Network %s (%s)\n", ni.Identifier, ni.Operator)
+	}
+	return 0
+}
+
+// runCheck connects once, waits for a frame and reports the result,
+// returning the exit code
+func runCheck(client *ntrip.Client, timeout time.Duration) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	msg, err := client.Check(ctx)
+	if err != nil {
+		fmt.Printf("FAIL %s/%s: %v\n", client.ServerAddr, client.Mountpoint, err)
+		return 1
+	}
+	fmt.Printf("OK %s/%s: RTCM %d received after %v\n", client.ServerAddr, client.Mountpoint, msg.Number, time.Since(started).Round(time.Millisecond))
+	return 0
+}
+
+// logBitrate logs the stream bitrate every interval until ctx is done
+func logBitrate(ctx context.Context, client *ntrip.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			slog.Info("Stream bitrate", "bps", client.Bitrate())
+		}
+	}
+}
+
+// logSummary logs the totals of the capture once the client exits, with
+// the average bitrate over the whole run
+func logSummary(client *ntrip.Client, elapsed time.Duration) {
+	bytes := client.BytesReceived()
+	var bps int64
+	if elapsed >= time.Second {
+		bps = int64(float64(bytes*8) / elapsed.Seconds())
+	}
+	slog.Info("Capture finished", "bytes", bytes, "duration", elapsed.Round(100*time.Millisecond), "bps", bps, "file", client.OutputFile)
+	logCounts(client)
+	if client.CheckContinuity {
+		gaps := client.Gaps()
+		slog.Info("RTCM continuity", "gaps", gaps.Gaps, "missed_epochs", gaps.Missed, "longest_gap", gaps.Longest)
+	}
+}
+
+// logCounts logs the received frames per RTCM message type
+func logCounts(client *ntrip.Client) {
+	counts := client.MessageCounts()
+	var summary []string
+	for _, t := range slices.Sorted(maps.Keys(counts)) {
+		summary = append(summary, fmt.Sprintf("%d=%d", t, counts[t]))
+	}
+	slog.Info("RTCM message counts", "counts", strings.Join(summary, " "))
+}
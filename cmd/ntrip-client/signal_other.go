@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyCounts does nothing, there is no SIGUSR1 here and the counts are
+// only printed once the client exits
+func notifyCounts(c chan<- os.Signal) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyCounts relays SIGUSR1, which asks for the message counts, to c
+func notifyCounts(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,85 @@
+// Command ntrip-replay serves a recorded capture over NTRIP, so rovers can
+// be tested against known data without a live base.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"ntrip"
+)
+
+func main() {
+	file := flag.String("file", "", "Capture to replay, as written by ntrip-client")
+	host := flag.String("host", "", "Address to listen on, empty for all interfaces")
+	port := flag.Int("port", 2101, "Port to serve NTRIP on")
+	mountpoint := flag.String("mountpoint", "RTCM3", "Mountpoint the capture is served as")
+	rate := flag.String("rate", "realtime", "Playback rate: realtime, max, or epochs per second")
+	loop := flag.Bool("loop", false, "Start over at the end of the capture")
+	timestamped := flag.Bool("timestamped", false, "The capture was written with ntrip-client -timestamped, realtime replays it at its original timing")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	flag.Parse()
+	if *file == "" && flag.NArg() == 1 {
+		*file = flag.Arg(0)
+	}
+	if *file == "" {
+		log.Fatal("No capture given, use -file")
+	}
+	if err := ntrip.SetupLogging(*logLevel, "text"); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+
+	source := ntrip.SerialConfig{Type: "file", Path: *file, Loop: *loop, Timestamped: *timestamped}
+	if err := setRate(&source, *rate); err != nil {
+		log.Fatal(err)
+	}
+	var config ntrip.Config
+	config.Server.Host = *host
+	config.Server.Port = *port
+	config.Serial = source
+	config.Mountpoints = []ntrip.MountpointConfig{{Name: *mountpoint, Description: "Replay of " + *file}}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid replay settings:\n%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := ntrip.NewServer(config)
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	slog.Info("Replaying capture", "file", *file, "mountpoint", *mountpoint, "rate", *rate, "loop", *loop)
+
+	<-ctx.Done()
+	slog.Info("Shutting down replay")
+	server.Wait()
+}
+
+// setRate paces the replay: realtime keeps the original timing of a
+// timestamped capture and sends a raw one at one epoch per second, max
+// sends as fast as clients read, and a number is epochs per second
+func setRate(source *ntrip.SerialConfig, rate string) error {
+	switch rate {
+	case "realtime":
+		if source.Timestamped {
+			source.Realtime = true
+		} else {
+			source.Rate = 1
+		}
+	case "max":
+	default:
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return fmt.Errorf("invalid -rate %q, want realtime, max or a positive number of epochs per second", rate)
+		}
+		source.Rate = r
+	}
+	return nil
+}
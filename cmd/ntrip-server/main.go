@@ -0,0 +1,76 @@
+// Command ntrip-server runs an NTRIP caster configured from a YAML file.
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"ntrip"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	configPath := flag.String("config", "config.yaml", "Path or http(s) URL of the configuration file, - for stdin, empty to configure from the environment and flags only")
+	overrides := ntrip.ConfigFlags(flag.CommandLine)
+	logLevel := flag.String("log-level", "", "Log level: debug, info, warn or error (default from config, else info)")
+	logFormat := flag.String("log-format", "", "Log format: text or json (default from config, else text)")
+	flag.Parse()
+
+	config, err := ntrip.LoadConfig(*configPath, overrides)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	level := cmp.Or(*logLevel, config.Logging.Level, "info")
+	format := cmp.Or(*logFormat, config.Logging.Format, "text")
+	if err := ntrip.SetupLogging(level, format); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	}
+
+	// Handle graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := ntrip.NewServer(config)
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+
+	// Reload the configuration on SIGHUP, keeping connected clients
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if *configPath == "-" {
+				slog.Warn("Configuration was read from stdin and cannot be reloaded, restart the server to change it")
+				continue
+			}
+			config, err := ntrip.LoadConfig(*configPath, overrides)
+			if err != nil {
+				slog.Error("Failed to reload configuration", "err", err)
+				continue
+			}
+			server.Reload(config)
+		}
+	}()
+
+	// Drain on SIGUSR2, letting clients go on a frame boundary, then exit
+	usr2 := make(chan os.Signal, 1)
+	notifyDrain(usr2)
+	go func() {
+		<-usr2
+		server.Drain(server.DrainTimeout())
+		stop()
+	}()
+
+	<-ctx.Done()
+	signal.Stop(hup)
+	signal.Stop(usr2)
+	slog.Info("Shutting down server")
+	server.Wait()
+	slog.Info("Server stopped")
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyDrain does nothing, there is no SIGUSR2 here and the server only
+// stops on an interrupt
+func notifyDrain(c chan<- os.Signal) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDrain relays SIGUSR2, which asks the server to drain, to c
+func notifyDrain(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
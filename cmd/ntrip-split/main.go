@@ -0,0 +1,108 @@
+// Command ntrip-split splits a capture into a file per RTCM message type
+// or group of types, such as just the MSM observations or the ephemeris.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ntrip"
+)
+
+func main() {
+	file := flag.String("file", "", "Capture to split, as written by ntrip-client, optionally gzipped")
+	prefix := flag.String("prefix", "", "Start of the names of the files written, by default the capture's name without extension")
+	var groups []ntrip.MessageGroup
+	flag.Func("group", "Write types to a shared file: msm, legacy, ephemeris, station, or name=1004,1071-1077 (repeatable)", func(value string) error {
+		g, err := parseGroup(value)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, g)
+		return nil
+	})
+	only := flag.Bool("only", false, "Drop message types in no -group instead of writing a file per type")
+	timestamped := flag.Bool("timestamped", false, "The capture was written with ntrip-client -timestamped, the files keep the arrival times")
+	flag.Parse()
+	if *file == "" && flag.NArg() == 1 {
+		*file = flag.Arg(0)
+	}
+	if *file == "" {
+		log.Fatal("No capture given, use -file")
+	}
+	if *only && len(groups) == 0 {
+		log.Fatal("-only needs at least one -group")
+	}
+
+	result, err := ntrip.SplitCapture(*file, ntrip.SplitOptions{
+		Prefix:      *prefix,
+		Groups:      groups,
+		GroupsOnly:  *only,
+		Timestamped: *timestamped,
+	})
+	if err != nil {
+		log.Fatalf("Failed to split %s: %v", *file, err)
+	}
+	report(result)
+}
+
+// parseGroup parses a standard group name or name=types, where types is a
+// comma separated list of message numbers and ranges
+func parseGroup(value string) (ntrip.MessageGroup, error) {
+	name, list, ok := strings.Cut(value, "=")
+	if !ok {
+		g, ok := ntrip.StandardGroup(value)
+		if !ok {
+			return g, fmt.Errorf("unknown group %q, want msm, legacy, ephemeris, station or name=types", value)
+		}
+		return g, nil
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return ntrip.MessageGroup{}, fmt.Errorf("invalid group name %q", name)
+	}
+	g := ntrip.MessageGroup{Name: name}
+	for _, item := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		first, err := strconv.Atoi(lo)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(hi)
+		}
+		if err != nil || first < 1 || last < first || last > 4095 {
+			return g, fmt.Errorf("invalid message types %q in group %s", item, name)
+		}
+		for n := first; n <= last; n++ {
+			g.Types = append(g.Types, n)
+		}
+	}
+	return g, nil
+}
+
+// report prints the files written and the message counts of the capture
+func report(result ntrip.SplitResult) {
+	for _, f := range result.Files {
+		fmt.Printf("%s: %d frames, %d bytes\n", f.Name, f.Frames, f.Bytes)
+	}
+	types := make([]int, 0, len(result.Counts))
+	for n := range result.Counts {
+		types = append(types, n)
+	}
+	sort.Ints(types)
+	fmt.Println("Messages read:")
+	for _, n := range types {
+		fmt.Printf("  %d: %d\n", n, result.Counts[n])
+	}
+	if result.Dropped > 0 {
+		fmt.Printf("Dropped %d frames in no group\n", result.Dropped)
+	}
+	if result.Discarded > 0 || result.CRCErrors > 0 {
+		fmt.Printf("Skipped %d bytes outside valid frames, %d CRC errors\n", result.Discarded, result.CRCErrors)
+	}
+	if result.Truncated > 0 {
+		fmt.Printf("Left out %d bytes of an incomplete frame at the end\n", result.Truncated)
+	}
+}
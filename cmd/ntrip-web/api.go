@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	errClientRunning = errors.New("client already running")
+	errClientStopped = errors.New("no client running")
+	errOutputInUse   = errors.New("output file in use by another session")
+	errNoSession     = errors.New("no such session")
+)
+
+// StatusResponse is the body of GET /api/status and of the start and
+// stop responses
+type StatusResponse struct {
+	Session       string      `json:"session,omitempty"`
+	Status        string      `json:"status"`
+	Running       bool        `json:"running"`
+	Config        Config      `json:"config"`
+	OutputFile    string      `json:"output_file,omitempty"`
+	BytesReceived int64       `json:"bytes_received"`
+	Bitrate       int         `json:"bitrate"` // Bits per second over about 10s
+	MessageCounts map[int]int `json:"message_counts"`
+	// Station is the base position from the last 1005/1006 message
+	Station *StationView `json:"station,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// FileInfo describes a capture listed by GET /api/files
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// writeJSON encodes v as the response body
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding API response", "err", err)
+	}
+}
+
+// sessionStatus snapshots a session's state for the API
+func sessionStatus(s *Session) StatusResponse {
+	mutex.Lock()
+	defer mutex.Unlock()
+	resp := StatusResponse{
+		Session:       s.ID,
+		Status:        s.Status,
+		Running:       s.cancel != nil,
+		Config:        s.Config,
+		BytesReceived: s.bytesRecv,
+		Bitrate:       s.bitrate(),
+		MessageCounts: make(map[int]int, len(s.counts)),
+		Station:       s.station,
+	}
+	resp.Config.Password = ""
+	if resp.Running {
+		resp.OutputFile = s.OutputFile
+	}
+	for t, n := range s.counts {
+		resp.MessageCounts[t] = n
+	}
+	return resp
+}
+
+// methodAllowed rejects requests other than POST
+func methodAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, StatusResponse{Error: "method not allowed"})
+		return false
+	}
+	return true
+}
+
+// handleAPIStart starts a new session, or restarts the stopped session
+// named by the session parameter. The optional JSON body overrides the
+// configured fields it sets.
+func handleAPIStart(w http.ResponseWriter, r *http.Request) {
+	if !methodAllowed(w, r) {
+		return
+	}
+
+	id := r.URL.Query().Get("session")
+	var s *Session
+	mutex.Lock()
+	config := clientConfig
+	mutex.Unlock()
+	if id != "" {
+		var err error
+		if s, err = findSession(id); err != nil {
+			writeJSON(w, http.StatusNotFound, StatusResponse{Session: id, Error: err.Error()})
+			return
+		}
+		mutex.Lock()
+		config = s.Config
+		mutex.Unlock()
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, StatusResponse{Error: "invalid config: " + err.Error()})
+		return
+	}
+	if config.ServerAddr == "" || config.Mountpoint == "" || config.OutputFile == "" {
+		writeJSON(w, http.StatusBadRequest, StatusResponse{Error: "server, mountpoint and output are required"})
+		return
+	}
+
+	if s == nil {
+		s = newSession(config)
+		defer publish("sessions", nil)
+	} else {
+		mutex.Lock()
+		if s.cancel == nil {
+			s.Config = config
+		}
+		mutex.Unlock()
+	}
+
+	code := http.StatusOK
+	var errMsg string
+	if err := s.start(); err != nil {
+		code = http.StatusConflict
+		errMsg = err.Error()
+	}
+	status := sessionStatus(s)
+	status.Error = errMsg
+	if code != http.StatusOK && id == "" {
+		removeSession(s.ID)
+	}
+	writeJSON(w, code, status)
+}
+
+// handleAPIStop stops the session named by the session parameter, by
+// default the most recent one
+func handleAPIStop(w http.ResponseWriter, r *http.Request) {
+	if !methodAllowed(w, r) {
+		return
+	}
+	s, err := findSession(r.URL.Query().Get("session"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, StatusResponse{Error: err.Error()})
+		return
+	}
+	code := http.StatusOK
+	var errMsg string
+	if err := s.stop(); err != nil {
+		code = http.StatusConflict
+		errMsg = err.Error()
+	}
+	status := sessionStatus(s)
+	status.Error = errMsg
+	writeJSON(w, code, status)
+}
+
+// handleAPIStatus reports whether the session named by the session
+// parameter, by default the most recent one, is running and what it has
+// received
+func handleAPIStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	s, err := findSession(id)
+	if err != nil && id == "" {
+		// Nothing started yet
+		mutex.Lock()
+		resp := StatusResponse{Status: "Not running", Config: clientConfig, MessageCounts: map[int]int{}}
+		mutex.Unlock()
+		resp.Config.Password = ""
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, StatusResponse{Session: id, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, sessionStatus(s))
+}
+
+// handleAPISessions lists every session
+func handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	mutex.Lock()
+	list := make([]*Session, 0, len(sessionOrder))
+	for _, id := range sessionOrder {
+		list = append(list, sessions[id])
+	}
+	mutex.Unlock()
+
+	resp := make([]StatusResponse, 0, len(list))
+	for _, s := range list {
+		resp = append(resp, sessionStatus(s))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIFiles lists the saved captures
+func handleAPIFiles(w http.ResponseWriter, r *http.Request) {
+	files := []FileInfo{}
+	for _, name := range getFiles() {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		files = append(files, FileInfo{Name: name, Size: info.Size(), Modified: info.ModTime()})
+	}
+	writeJSON(w, http.StatusOK, files)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// requireAuth wraps h with HTTP basic authentication against a single
+// username and password
+func requireAuth(h http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+		if !ok || !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="NTRIP Client Control"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin refuses requests other than GET and HEAD that the browser
+// says come from another site. Browsers resend basic auth credentials
+// with cross-site form posts, so without this any page the user opens
+// could delete captures or start and stop sessions. Requests carrying
+// neither Origin nor Referer, as scripts send them, are let through.
+func sameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			source := r.Header.Get("Origin")
+			if source == "" {
+				source = r.Header.Get("Referer")
+			}
+			if source != "" {
+				if u, err := url.Parse(source); err != nil || u.Host != r.Host {
+					slog.Warn("Refusing cross-origin request", "method", r.Method, "path", r.URL.Path, "origin", source)
+					http.Error(w, "Cross-origin request refused", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
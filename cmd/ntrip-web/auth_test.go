@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		referer string
+		status  int
+	}{
+		{name: "cross-site GET", method: "GET", origin: "https://evil.example", status: http.StatusOK},
+		{name: "script POST", method: "POST", status: http.StatusOK},
+		{name: "same origin", method: "POST", origin: "http://ntrip.local:8080", status: http.StatusOK},
+		{name: "same referer", method: "POST", referer: "http://ntrip.local:8080/caster", status: http.StatusOK},
+		{name: "cross-site form", method: "POST", origin: "https://evil.example", status: http.StatusForbidden},
+		{name: "cross-site referer", method: "POST", referer: "https://evil.example/page", status: http.StatusForbidden},
+		{name: "other port", method: "POST", origin: "http://ntrip.local:9090", status: http.StatusForbidden},
+		{name: "opaque origin", method: "POST", origin: "null", status: http.StatusForbidden},
+		{name: "cross-site DELETE", method: "DELETE", origin: "https://evil.example", status: http.StatusForbidden},
+	}
+	h := sameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://ntrip.local:8080/", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
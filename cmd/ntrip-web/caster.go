@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ntrip"
+)
+
+// casterAdmin is the base URL of the admin server of an ntrip-server
+// whose clients the caster page shows, set by -caster-admin
+var casterAdmin string
+
+// casterToken is the caster's admin.token, sent to disconnect clients
+var casterToken string
+
+// casterPollInterval is how often the caster's clients are fetched while
+// a browser is watching
+const casterPollInterval = 2 * time.Second
+
+// casterHTTP talks to the caster's admin server
+var casterHTTP = &http.Client{Timeout: 5 * time.Second}
+
+// CasterClient is a rover connected to the caster, as shown on the page
+type CasterClient struct {
+	ID        string
+	Address   string
+	User      string
+	Connected string
+	Duration  string
+	BytesSent int64
+}
+
+// CasterMount is a mountpoint of the caster with its clients
+type CasterMount struct {
+	Name    string
+	Clients []CasterClient
+}
+
+// CasterData is the caster page, and the caster event refreshing it
+type CasterData struct {
+	Admin       string
+	Mountpoints []CasterMount
+	Message     string `json:",omitempty"`
+	Error       string `json:",omitempty"`
+}
+
+// casterURL returns the admin server address as a base URL, defaulting
+// to http when no scheme is given
+func casterURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimRight(addr, "/")
+}
+
+// fetchCasterClients gets the clients of each mountpoint from the
+// caster's /clients endpoint
+func fetchCasterClients() ([]ntrip.MountClients, error) {
+	resp, err := casterHTTP.Get(casterAdmin + "/clients")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caster answered %s", resp.Status)
+	}
+	var mounts []ntrip.MountClients
+	if err := json.NewDecoder(resp.Body).Decode(&mounts); err != nil {
+		return nil, fmt.Errorf("invalid client list from caster: %v", err)
+	}
+	return mounts, nil
+}
+
+// disconnectCasterClient asks the caster to drop the client with
+// connection ID id
+func disconnectCasterClient(id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, casterAdmin+"/clients/disconnect", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if casterToken != "" {
+		req.Header.Set("Authorization", "Bearer "+casterToken)
+	}
+	resp, err := casterHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("caster answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// casterView fetches the caster's clients for the page
+func casterView() CasterData {
+	data := CasterData{Admin: casterAdmin}
+	mounts, err := fetchCasterClients()
+	if err != nil {
+		data.Error = err.Error()
+		return data
+	}
+	now := time.Now()
+	for _, m := range mounts {
+		view := CasterMount{Name: m.Name, Clients: []CasterClient{}}
+		for _, c := range m.Clients {
+			view.Clients = append(view.Clients, CasterClient{
+				ID:        c.ID,
+				Address:   c.RemoteAddr,
+				User:      c.User,
+				Connected: c.Connected.Local().Format("2006-01-02 15:04:05"),
+				Duration:  now.Sub(c.Connected).Round(time.Second).String(),
+				BytesSent: c.BytesSent,
+			})
+		}
+		data.Mountpoints = append(data.Mountpoints, view)
+	}
+	return data
+}
+
+// pollCaster pushes the caster's clients to the browsers every
+// casterPollInterval, skipping the fetch while none is connected
+func pollCaster() {
+	ticker := time.NewTicker(casterPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if hasSubscribers() {
+			publish("caster", casterView())
+		}
+	}
+}
+
+var casterTemplate = template.Must(template.New("caster").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>NTRIP Client Control - Caster Clients</title>
+    <style>
+        body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+        table { border-collapse: collapse; width: 100%; margin-bottom: 20px; }
+        td, th { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; }
+        .message { padding: 10px; background-color: #f5f5f5; }
+        .error { padding: 10px; background-color: #fff1f0; border: 1px solid #ffa39e; }
+    </style>
+    <script>
+        // render replaces the mountpoint tables with those of an event
+        function render(data) {
+            document.getElementById("error").style.display = data.Error ? "" : "none";
+            document.getElementById("error").textContent = data.Error || "";
+            var div = document.getElementById("mountpoints");
+            div.textContent = "";
+            (data.Mountpoints || []).forEach(function(m) {
+                var h = document.createElement("h3");
+                h.textContent = m.Name + " (" + m.Clients.length + " client" + (m.Clients.length == 1 ? "" : "s") + ")";
+                div.appendChild(h);
+                if (m.Clients.length == 0) { return; }
+                var table = document.createElement("table");
+                table.createTHead().innerHTML = "<tr><th>ID</th><th>Address</th><th>User</th><th>Connected</th><th>Duration</th><th>Bytes Sent</th><th></th></tr>";
+                var body = table.createTBody();
+                m.Clients.forEach(function(c) {
+                    var row = body.insertRow();
+                    [c.ID, c.Address, c.User, c.Connected, c.Duration, c.BytesSent].forEach(function(v) {
+                        row.insertCell().textContent = v;
+                    });
+                    var form = document.createElement("form");
+                    form.method = "post";
+                    form.onsubmit = function() { return confirm("Disconnect " + c.Address + "?"); };
+                    form.innerHTML = '<input type="hidden" name="action" value="disconnect"><input type="hidden" name="id"><button type="submit">Disconnect</button>';
+                    form.elements.id.value = c.ID;
+                    row.insertCell().appendChild(form);
+                });
+                div.appendChild(table);
+            });
+        }
+        window.onload = function() {
+            var source = new EventSource("/events");
+            source.addEventListener("caster", function(e) {
+                render(JSON.parse(e.data));
+            });
+        };
+    </script>
+</head>
+<body>
+    <h1>Caster Clients</h1>
+    <p><a href="/">Back</a> | Caster admin server {{.Admin}}, updated every few seconds</p>
+    {{with .Message}}<p class="message">{{.}}</p>{{end}}
+    <p class="error" id="error" {{if not .Error}}style="display:none"{{end}}>{{.Error}}</p>
+    <div id="mountpoints">
+    {{range .Mountpoints}}
+        <h3>{{.Name}} ({{len .Clients}} client{{if ne (len .Clients) 1}}s{{end}})</h3>
+        {{if .Clients}}
+        <table>
+            <thead><tr><th>ID</th><th>Address</th><th>User</th><th>Connected</th><th>Duration</th><th>Bytes Sent</th><th></th></tr></thead>
+            <tbody>
+            {{range .Clients}}
+            <tr>
+                <td>{{.ID}}</td>
+                <td>{{.Address}}</td>
+                <td>{{.User}}</td>
+                <td>{{.Connected}}</td>
+                <td>{{.Duration}}</td>
+                <td>{{.BytesSent}}</td>
+                <td>
+                    <form method="post" onsubmit="return confirm('Disconnect {{.Address}}?')">
+                        <input type="hidden" name="action" value="disconnect">
+                        <input type="hidden" name="id" value="{{.ID}}">
+                        <button type="submit">Disconnect</button>
+                    </form>
+                </td>
+            </tr>
+            {{end}}
+            </tbody>
+        </table>
+        {{end}}
+    {{end}}
+    </div>
+</body>
+</html>
+`))
+
+// handleCaster shows the clients connected to each mountpoint of the
+// caster given by -caster-admin, kept live by caster events, and
+// disconnects the one posted with action=disconnect
+func handleCaster(w http.ResponseWriter, r *http.Request) {
+	if casterAdmin == "" {
+		http.Error(w, "No caster configured, start ntrip-web with -caster-admin", http.StatusNotFound)
+		return
+	}
+	var message string
+	if r.Method == http.MethodPost && r.FormValue("action") == "disconnect" {
+		id := r.FormValue("id")
+		if err := disconnectCasterClient(id); err != nil {
+			message = fmt.Sprintf("Error disconnecting client %s: %v", id, err)
+		} else {
+			message = fmt.Sprintf("Disconnected client %s", id)
+		}
+		addMessage(message)
+	}
+	data := casterView()
+	data.Message = message
+	casterTemplate.Execute(w, data)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadWebConfig reads the saved form defaults, keeping the built-in
+// defaults when no file has been saved yet
+func loadWebConfig(path string, defaults Config) (Config, error) {
+	config := defaults
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("error parsing config file: %v", err)
+	}
+
+	return config, nil
+}
+
+// saveWebConfig writes the form values as the new defaults. The password
+// is only stored when savePassword is set.
+func saveWebConfig(path string, config Config, savePassword bool) error {
+	if !savePassword {
+		config.Password = ""
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	// The file may hold a password, keep it private to the user
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// event is a single server-sent event pushed to the browser
+type event struct {
+	name string
+	data []byte
+}
+
+// StatusEvent reports a change in a session's running state
+type StatusEvent struct {
+	Session   string
+	Status    string
+	IsRunning bool
+}
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   = make(map[chan event]bool) // Open /events streams
+)
+
+// publish encodes v as JSON and queues it for every connected browser.
+// Browsers that fall behind miss the event rather than stall the client.
+func publish(name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Error encoding event", "event", name, "err", err)
+		return
+	}
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- event{name: name, data: data}:
+		default:
+		}
+	}
+}
+
+// hasSubscribers reports whether any browser is listening for events
+func hasSubscribers() bool {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	return len(subscribers) > 0
+}
+
+// handleEvents streams live updates to the browser as server-sent events
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan event, 64)
+	subscribersMu.Lock()
+	subscribers[ch] = true
+	subscribersMu.Unlock()
+	defer func() {
+		subscribersMu.Lock()
+		delete(subscribers, ch)
+		subscribersMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.name, ev.data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// lastMessage is the most recent message of a type seen by a session
+type lastMessage struct {
+	msg rtcm.Message
+	at  time.Time
+}
+
+// MessageDetail is a message shown on the inspect page with its decoded
+// fields
+type MessageDetail struct {
+	Type     int
+	Received string
+	Length   int
+	Fields   []string
+}
+
+// InspectData is the inspect page of a session
+type InspectData struct {
+	Session  string
+	Server   string
+	Messages []MessageDetail
+}
+
+// messageDetails decodes the last message of each type, ordered by type.
+// The caller holds mutex.
+func (s *Session) messageDetails() []MessageDetail {
+	details := make([]MessageDetail, 0, len(s.latest))
+	for _, last := range s.latest {
+		details = append(details, MessageDetail{
+			Type:     last.msg.Number,
+			Received: last.at.Format("15:04:05.000"),
+			Length:   len(last.msg.Payload),
+			Fields:   describe(last.msg),
+		})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Type < details[j].Type })
+	return details
+}
+
+// describe decodes the fields of the message types the rtcm package
+// understands
+func describe(msg rtcm.Message) []string {
+	fail := func(err error) []string { return []string{"Invalid: " + err.Error()} }
+	switch {
+	case msg.Number == 1005 || msg.Number == 1006:
+		arp, err := rtcm.ParseStationARP(msg.Payload)
+		if err != nil {
+			return fail(err)
+		}
+		lat, lon, height := arp.Geodetic()
+		fields := []string{
+			fmt.Sprintf("Station ID %d, ITRF realization year %d", arp.StationID, arp.ITRFYear),
+			fmt.Sprintf("ECEF X/Y/Z: %.4f / %.4f / %.4f m", arp.X, arp.Y, arp.Z),
+			fmt.Sprintf("Lat/Lon: %.8f, %.8f, ellipsoidal height %.3f m", lat, lon, height),
+		}
+		if msg.Number == 1006 {
+			fields = append(fields, fmt.Sprintf("Antenna height %.4f m", arp.Height))
+		}
+		return fields
+	case msg.Number == 1033:
+		d, err := rtcm.ParseDescriptor(msg.Payload)
+		if err != nil {
+			return fail(err)
+		}
+		return []string{
+			fmt.Sprintf("Station ID %d", d.StationID),
+			fmt.Sprintf("Antenna %q, setup ID %d, serial %q", d.Antenna, d.AntennaSetup, d.AntennaSerial),
+			fmt.Sprintf("Receiver %q, firmware %q, serial %q", d.Receiver, d.Firmware, d.ReceiverSerial),
+		}
+	case msg.Number == 1230:
+		b, err := rtcm.ParseGLONASSBiases(msg.Payload)
+		if err != nil {
+			return fail(err)
+		}
+		fields := []string{fmt.Sprintf("Station ID %d, observations aligned: %v", b.StationID, b.Aligned)}
+		if len(b.Biases) == 0 {
+			fields = append(fields, "No biases reported")
+		}
+		names := make([]string, 0, len(b.Biases))
+		for name := range b.Biases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields = append(fields, fmt.Sprintf("%s bias %.2f m", name, b.Biases[name]))
+		}
+		return fields
+	case rtcm.IsMSM(msg.Number):
+		h, err := rtcm.ParseMSMHeader(msg.Payload)
+		if err != nil {
+			return fail(err)
+		}
+		epoch := fmt.Sprintf("Epoch %d ms of the week", h.Epoch)
+		if h.Number >= 1081 && h.Number <= 1087 {
+			epoch = fmt.Sprintf("Epoch %d ms of day %d", h.Epoch, h.GLONASSDay)
+		}
+		return []string{
+			fmt.Sprintf("Station ID %d, IODS %d, multiple message: %v", h.StationID, h.IODS, h.MultipleMsg),
+			epoch,
+			fmt.Sprintf("%d satellites: %s", len(h.Satellites), joinInts(h.Satellites)),
+			fmt.Sprintf("%d signals: %s", len(h.Signals), joinInts(h.Signals)),
+			fmt.Sprintf("%d signal observations", h.Cells),
+		}
+	}
+	return nil
+}
+
+// joinInts lists numbers separated by spaces
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, " ")
+}
+
+var inspectTemplate = template.Must(template.New("inspect").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>NTRIP Client Control - Inspect Session {{.Session}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+        table { border-collapse: collapse; width: 100%; }
+        td, th { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; vertical-align: top; }
+        td p { margin: 0 0 4px 0; }
+    </style>
+</head>
+<body>
+    <h1>Session {{.Session}}: {{.Server}}</h1>
+    <p><a href="/">Back</a> | <a href="/inspect?session={{.Session}}">Refresh</a></p>
+    <h3>Last Message of Each Type</h3>
+    <table>
+        <thead><tr><th>Type</th><th>Received</th><th>Bytes</th><th>Decoded</th></tr></thead>
+        <tbody>
+        {{range .Messages}}
+        <tr>
+            <td>{{.Type}}</td>
+            <td>{{.Received}}</td>
+            <td>{{.Length}}</td>
+            <td>{{range .Fields}}<p>{{.}}</p>{{else}}<p>Not decoded</p>{{end}}</td>
+        </tr>
+        {{end}}
+        </tbody>
+    </table>
+    {{if not .Messages}}<p>No RTCM messages decoded yet</p>{{end}}
+</body>
+</html>
+`))
+
+// handleInspect shows the last message of each type of the session named
+// by the session parameter, by default the most recent one, decoded
+func handleInspect(w http.ResponseWriter, r *http.Request) {
+	s, err := findSession(r.URL.Query().Get("session"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	mutex.Lock()
+	data := InspectData{
+		Session:  s.ID,
+		Server:   s.Config.ServerAddr + "/" + s.Config.Mountpoint,
+		Messages: s.messageDetails(),
+	}
+	mutex.Unlock()
+	inspectTemplate.Execute(w, data)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// virtualInterfaces are name prefixes of bridges and tunnels other devices
+// on the LAN cannot reach the interface through
+var virtualInterfaces = []string{"docker", "br-", "veth", "virbr", "vmnet", "vboxnet", "cni", "flannel", "cali", "lxc", "lxd", "podman", "tun", "tap", "wg", "zt", "tailscale", "utun"}
+
+// localIPs returns the addresses the web interface is likely reachable on
+// from other devices, best first: IPv4 before IPv6, and within each family
+// the source address of the default route before the other addresses of
+// interfaces that are up and not loopback or virtual. It returns
+// "localhost" when there are none.
+func localIPs() []string {
+	var addrs []net.IP
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || isVirtual(iface.Name) {
+			continue
+		}
+		ifaddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaddrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			addrs = append(addrs, ipnet.IP)
+		}
+	}
+	return orderIPs(routeSource("192.0.2.1:9"), routeSource("[2001:db8::1]:9"), addrs)
+}
+
+// orderIPs lists the IPv4 route source and interface addresses, then the
+// IPv6 ones, without duplicates. Either route source may be nil.
+func orderIPs(route4, route6 net.IP, addrs []net.IP) []string {
+	var ips []string
+	seen := make(map[string]bool)
+	add := func(ip net.IP) {
+		if s := ip.String(); ip != nil && !seen[s] {
+			seen[s] = true
+			ips = append(ips, s)
+		}
+	}
+	for _, v4 := range []bool{true, false} {
+		if v4 {
+			add(route4)
+		} else {
+			add(route6)
+		}
+		for _, ip := range addrs {
+			if (ip.To4() != nil) == v4 {
+				add(ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return []string{"localhost"}
+	}
+	return ips
+}
+
+// routeSource returns the local address the kernel would send packets to
+// target from, which belongs to the interface of the default route. No
+// packets are sent.
+func routeSource(target string) net.IP {
+	network := "udp4"
+	if strings.HasPrefix(target, "[") {
+		network = "udp6"
+	}
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return nil
+	}
+	return ip
+}
+
+// isVirtual reports whether an interface name looks like a bridge or tunnel
+func isVirtual(name string) bool {
+	for _, prefix := range virtualInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
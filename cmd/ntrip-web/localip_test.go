@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestOrderIPs(t *testing.T) {
+	ips := func(s ...string) []net.IP {
+		var out []net.IP
+		for _, a := range s {
+			out = append(out, net.ParseIP(a))
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		route4 string
+		route6 string
+		addrs  []net.IP
+		want   []string
+	}{
+		{name: "none", want: []string{"localhost"}},
+		{
+			name:   "both routes",
+			route4: "192.168.1.10",
+			route6: "2001:db8::10",
+			addrs:  ips("2001:db8::20", "10.0.0.5", "192.168.1.10", "2001:db8::10"),
+			want:   []string{"192.168.1.10", "10.0.0.5", "2001:db8::10", "2001:db8::20"},
+		},
+		{
+			name:   "IPv6 route only",
+			route6: "2001:db8::10",
+			addrs:  ips("2001:db8::10", "10.0.0.5"),
+			want:   []string{"10.0.0.5", "2001:db8::10"},
+		},
+		{
+			name:  "no routes",
+			addrs: ips("2001:db8::20", "10.0.0.5"),
+			want:  []string{"10.0.0.5", "2001:db8::20"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orderIPs(net.ParseIP(tt.route4), net.ParseIP(tt.route6), tt.addrs)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,710 @@
+// Command ntrip-web serves a browser interface for running the NTRIP client.
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ntrip"
+	"ntrip/rtcm"
+)
+
+type Config struct {
+	ServerAddr string `yaml:"server" json:"server"`
+	Mountpoint string `yaml:"mountpoint" json:"mountpoint"`
+	Username   string `yaml:"username" json:"username"`
+	Password   string `yaml:"password,omitempty" json:"password,omitempty"`
+	OutputFile string `yaml:"output" json:"output"`
+}
+
+type PageData struct {
+	Config   Config // Form values for the next session
+	Sessions []SessionView
+	Messages []string
+	ServerIP string
+	// OtherIPs are further addresses the interface may be reachable on
+	OtherIPs []string
+	MaxLines int
+	// BufferSize is the bytes of RTCM data shown per session
+	BufferSize int
+	Files      []string
+	// RTCMErrors are the most recent CRC failures and skipped data of all
+	// sessions, oldest first
+	RTCMErrors    []RTCMError
+	MaxRTCMErrors int
+	// Caster is set with -caster-admin, linking the caster clients page
+	Caster bool
+}
+
+// RTCMError is data a session's framer rejected
+type RTCMError struct {
+	Time    string
+	Session string
+	Offset  int64
+	Error   string
+}
+
+// maxRTCMErrors is how many RTCM errors the page keeps
+const maxRTCMErrors = 20
+
+// MessageCount is the number of frames received for an RTCM message type
+type MessageCount struct {
+	Type  int
+	Count int
+}
+
+var (
+	clientConfig Config // Form values, used for new sessions
+	configPath   string // Where "Save as default" writes the form values
+	pageData     PageData
+	mutex        sync.Mutex
+)
+
+// rtcmBufferSize is the bytes of RTCM data kept for each session's hex
+// dump, 16 to a line, set by -buffer-size
+var rtcmBufferSize = 4096
+
+// maxDumpLines is how many hex dump lines a session keeps
+func maxDumpLines() int {
+	return rtcmBufferSize / 16
+}
+
+func addMessage(msg string) {
+	msg = fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg)
+	mutex.Lock()
+	pageData.Messages = append(pageData.Messages, msg)
+	if len(pageData.Messages) > 10 {
+		pageData.Messages = pageData.Messages[1:]
+	}
+	mutex.Unlock()
+	publish("message", msg)
+}
+
+// addRTCMError records a rejected frame or skipped data of a session
+func addRTCMError(session string, fe rtcm.FrameError) {
+	e := RTCMError{Time: time.Now().Format("15:04:05"), Session: session, Offset: fe.Offset, Error: fe.Error()}
+	mutex.Lock()
+	pageData.RTCMErrors = append(pageData.RTCMErrors, e)
+	if len(pageData.RTCMErrors) > maxRTCMErrors {
+		pageData.RTCMErrors = pageData.RTCMErrors[1:]
+	}
+	mutex.Unlock()
+	publish("rtcmerror", e)
+}
+
+// sortedCounts returns the message type counts ordered by type
+func sortedCounts(counts map[int]int) []MessageCount {
+	result := make([]MessageCount, 0, len(counts))
+	for t, n := range counts {
+		result = append(result, MessageCount{Type: t, Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
+
+func getFiles() []string {
+	files, err := filepath.Glob(captureGlob)
+	if err != nil {
+		return nil
+	}
+	return files
+}
+
+// captureGlob matches the files the client writes
+const captureGlob = "rtcm_data.bin_*"
+
+// isCaptureFile reports whether name is a capture in the working
+// directory, rejecting anything that could reach other paths
+func isCaptureFile(name string) bool {
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	ok, err := filepath.Match(captureGlob, name)
+	return err == nil && ok
+}
+
+// downloadFile streams a capture to the browser as an attachment,
+// compressing it on the fly to a .gz file when compress is set
+func downloadFile(w http.ResponseWriter, r *http.Request, filename string, compress bool) error {
+	if !isCaptureFile(filename) {
+		return fmt.Errorf("invalid file name: %q", filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if compress {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".gz"))
+		zw := gzip.NewWriter(w)
+		if _, err := io.Copy(zw, f); err != nil {
+			slog.Error("Error sending compressed file", "file", filename, "err", err)
+			return nil
+		}
+		if err := zw.Close(); err != nil {
+			slog.Error("Error sending compressed file", "file", filename, "err", err)
+		}
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	http.ServeContent(w, r, filename, info.ModTime(), f)
+	return nil
+}
+
+// deleteFile removes a capture from the working directory
+func deleteFile(filename string) error {
+	if !isCaptureFile(filename) {
+		return fmt.Errorf("invalid file name: %q", filename)
+	}
+	return os.Remove(filename)
+}
+
+// convertToReadable writes a hex dump of a capture next to it, gzipped
+// to .txt.gz when compress is set. The capture is streamed so large files
+// don't have to fit in memory.
+func convertToReadable(filename string, compress bool) error {
+	// The name comes straight from the form, only touch our own captures
+	if !isCaptureFile(filename) {
+		return fmt.Errorf("invalid file name: %q", filename)
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Create a new file with .txt extension
+	outputFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".txt"
+	if compress {
+		outputFile += ".gz"
+	}
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var dst io.Writer = out
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(out)
+		dst = zw
+	}
+	w := bufio.NewWriter(dst)
+	if err := writeDump(w, bufio.NewReader(in)); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// writeDump converts binary data to a readable hex and ASCII dump
+func writeDump(w *bufio.Writer, r io.Reader) error {
+	w.WriteString("RTCM Data Dump\n")
+	w.WriteString("==============\n\n")
+
+	// Process data in chunks
+	line := make([]byte, 16)
+	for offset := 0; ; offset += 16 {
+		n, err := io.ReadFull(r, line)
+		if n == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		// Write offset
+		fmt.Fprintf(w, "%08x  ", offset)
+
+		// Write hex values
+		for _, b := range line[:n] {
+			fmt.Fprintf(w, "%02x ", b)
+		}
+
+		// Add padding if needed
+		if n < 16 {
+			w.WriteString(strings.Repeat("   ", 16-n))
+		}
+
+		// Write ASCII representation
+		w.WriteString(" |")
+		for _, b := range line[:n] {
+			if b >= 32 && b <= 126 {
+				w.WriteByte(b)
+			} else {
+				w.WriteByte('.')
+			}
+		}
+		w.WriteString("|\n")
+		if err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if action := r.FormValue("action"); action == "convert" || action == "convert_gzip" {
+			filename := r.FormValue("file")
+			err := convertToReadable(filename, action == "convert_gzip")
+			if err != nil {
+				addMessage(fmt.Sprintf("Error converting file: %v", err))
+			} else {
+				addMessage(fmt.Sprintf("Successfully converted %s to readable format", filename))
+			}
+		} else if r.FormValue("action") == "download" {
+			filename := r.FormValue("file")
+			err := downloadFile(w, r, filename, r.FormValue("gzip") != "")
+			if err == nil {
+				return
+			}
+			addMessage(fmt.Sprintf("Error downloading file: %v", err))
+		} else if r.FormValue("action") == "delete" {
+			filename := r.FormValue("file")
+			err := deleteFile(filename)
+			if err != nil {
+				addMessage(fmt.Sprintf("Error deleting file: %v", err))
+			} else {
+				addMessage(fmt.Sprintf("Deleted %s", filename))
+			}
+		} else if action := r.FormValue("action"); action == "stop" || action == "restart" || action == "remove" {
+			handleSessionAction(action, r.FormValue("session"))
+		} else {
+			mutex.Lock()
+			clientConfig.ServerAddr = r.FormValue("server")
+			clientConfig.Mountpoint = r.FormValue("mountpoint")
+			clientConfig.Username = r.FormValue("username")
+			clientConfig.Password = r.FormValue("password")
+			clientConfig.OutputFile = r.FormValue("output")
+			config := clientConfig
+			mutex.Unlock()
+			if r.FormValue("save_default") != "" {
+				err := saveWebConfig(configPath, config, r.FormValue("save_password") != "")
+				if err != nil {
+					addMessage(fmt.Sprintf("Error saving defaults: %v", err))
+				} else {
+					addMessage("Saved settings as default to " + configPath)
+				}
+			}
+			if action == "start" {
+				if s := newSession(config); s.start() != nil {
+					removeSession(s.ID)
+				}
+				publish("sessions", nil)
+			}
+		}
+	}
+
+	files := getFiles()
+	views := sessionViews()
+
+	tmpl := template.Must(template.New("index").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>NTRIP Client Control</title>
+    <style>
+        body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+        .form-group { margin-bottom: 15px; }
+        label { display: block; margin-bottom: 5px; }
+        input[type="text"], input[type="password"] { width: 100%; padding: 8px; margin-bottom: 10px; }
+        .button-group { margin-top: 20px; }
+        button { padding: 10px 20px; margin-right: 10px; cursor: pointer; }
+        button:disabled { opacity: 0.5; cursor: not-allowed; }
+        .status { margin-top: 20px; padding: 10px; border: 1px solid #ccc; }
+        .messages { margin-top: 20px; padding: 10px; border: 1px solid #ccc; max-height: 200px; overflow-y: auto; }
+        .message { margin: 5px 0; padding: 5px; background-color: #f5f5f5; }
+        .connection-info { margin-top: 20px; padding: 10px; background-color: #e6f7ff; border: 1px solid #91d5ff; }
+        .data-display { margin-top: 20px; padding: 10px; border: 1px solid #ccc; background-color: #f8f8f8; font-family: monospace; white-space: pre; overflow-x: auto; max-height: 300px; overflow-y: auto; }
+        .data-display pre { margin: 0; padding: 0; }
+        .files-list { margin-top: 20px; padding: 10px; border: 1px solid #ccc; }
+        .file-item { margin: 5px 0; padding: 5px; background-color: #f5f5f5; display: flex; justify-content: space-between; align-items: center; }
+        .refresh-controls { margin-top: 10px; }
+        .message-types { margin-top: 20px; padding: 10px; border: 1px solid #ccc; }
+        .message-types table { border-collapse: collapse; }
+        .message-types td, .message-types th { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; }
+        .station { padding: 10px; background-color: #e6f7ff; border: 1px solid #91d5ff; }
+        .station-missing { padding: 10px; background-color: #fff1f0; border: 1px solid #ffa39e; }
+        .session { margin-top: 30px; padding-top: 10px; border-top: 2px solid #ccc; }
+    </style>
+    <script>
+        var paused = false;
+        var maxLines = {{.MaxLines}};
+        var lineCounts = {}; // Hex dump lines shown per session
+        function countLines(text) {
+            return text.split("\n").length - 1;
+        }
+        var maxRTCMErrors = {{.MaxRTCMErrors}};
+        function togglePause(button) {
+            paused = !paused;
+            button.textContent = paused ? "Resume Live Updates" : "Pause Live Updates";
+        }
+        window.onload = function() {
+            var source = new EventSource("/events");
+            source.addEventListener("data", function(e) {
+                if (paused) { return; }
+                var ev = JSON.parse(e.data);
+                var pre = document.getElementById("rtcm-data-" + ev.Session);
+                if (!pre) { return; }
+                // Append the new lines and drop the oldest, so large
+                // buffers are not re-rendered as a whole on every chunk
+                if (!(ev.Session in lineCounts)) {
+                    lineCounts[ev.Session] = countLines(pre.textContent);
+                }
+                pre.appendChild(document.createTextNode(ev.Lines));
+                var count = lineCounts[ev.Session] + countLines(ev.Lines);
+                while (count > maxLines) {
+                    var first = pre.firstChild;
+                    var n = countLines(first.data);
+                    if (count - n >= maxLines) {
+                        pre.removeChild(first);
+                        count -= n;
+                        continue;
+                    }
+                    var cut = 0;
+                    for (; count > maxLines; count--) {
+                        cut = first.data.indexOf("\n", cut) + 1;
+                    }
+                    first.data = first.data.slice(cut);
+                }
+                lineCounts[ev.Session] = count;
+                document.getElementById("no-data-" + ev.Session).style.display = "none";
+            });
+            source.addEventListener("counts", function(e) {
+                if (paused) { return; }
+                var ev = JSON.parse(e.data);
+                var body = document.getElementById("msg-counts-" + ev.Session);
+                if (!body) { return; }
+                body.innerHTML = "";
+                ev.Counts.forEach(function(c) {
+                    var row = body.insertRow();
+                    row.insertCell().textContent = c.Type;
+                    row.insertCell().textContent = c.Count;
+                });
+                document.getElementById("no-counts-" + ev.Session).style.display = "none";
+                document.getElementById("bitrate-" + ev.Session).textContent = ev.Bitrate;
+            });
+            source.addEventListener("station", function(e) {
+                var ev = JSON.parse(e.data);
+                var div = document.getElementById("station-" + ev.Session);
+                if (!div) { return; }
+                var st = ev.Station;
+                div.className = "station";
+                div.textContent = "";
+                [
+                    "Message " + st.message + ", station ID " + st.station_id,
+                    "ECEF X/Y/Z: " + st.x.toFixed(4) + " / " + st.y.toFixed(4) + " / " + st.z.toFixed(4) + " m",
+                    "Lat/Lon: " + st.latitude.toFixed(8) + ", " + st.longitude.toFixed(8),
+                    "Ellipsoidal height: " + st.height.toFixed(3) + " m" + (st.message == 1006 ? ", antenna height: " + st.antenna_height.toFixed(4) + " m" : "")
+                ].forEach(function(text) {
+                    var p = document.createElement("p");
+                    p.textContent = text;
+                    div.appendChild(p);
+                });
+            });
+            // Sessions added or removed elsewhere, e.g. through the API
+            source.addEventListener("sessions", function(e) {
+                location.reload();
+            });
+            source.addEventListener("message", function(e) {
+                var list = document.getElementById("messages");
+                var div = document.createElement("div");
+                div.className = "message";
+                div.textContent = JSON.parse(e.data);
+                list.appendChild(div);
+                while (list.children.length > 10) {
+                    list.removeChild(list.firstChild);
+                }
+            });
+            source.addEventListener("rtcmerror", function(e) {
+                var ev = JSON.parse(e.data);
+                var body = document.getElementById("rtcm-errors");
+                var row = body.insertRow();
+                [ev.Time, ev.Session, ev.Offset, ev.Error].forEach(function(v) {
+                    row.insertCell().textContent = v;
+                });
+                while (body.rows.length > maxRTCMErrors) {
+                    body.deleteRow(0);
+                }
+                document.getElementById("no-rtcm-errors").style.display = "none";
+            });
+            source.addEventListener("status", function(e) {
+                var st = JSON.parse(e.data);
+                var status = document.getElementById("status-" + st.Session);
+                if (!status) { return; }
+                status.textContent = st.Status;
+                document.getElementById("restart-" + st.Session).disabled = st.IsRunning;
+                document.getElementById("stop-" + st.Session).disabled = !st.IsRunning;
+                document.getElementById("remove-" + st.Session).disabled = st.IsRunning;
+            });
+        };
+    </script>
+</head>
+<body>
+    <h1>NTRIP Client Control</h1>
+    <div class="connection-info">
+        <h3>Connection Information</h3>
+        <p>Server IP: {{.ServerIP}}</p>
+        {{if .OtherIPs}}<p>Other addresses: {{range $i, $ip := .OtherIPs}}{{if $i}}, {{end}}{{$ip}}{{end}}</p>{{end}}
+        <p>Access this interface from other devices on your network using the IP address above.</p>
+        {{if .Caster}}<p><a href="/caster">Caster clients</a></p>{{end}}
+    </div>
+    <form method="post">
+        <div class="form-group">
+            <label for="server">Server Address:</label>
+            <input type="text" id="server" name="server" value="{{.Config.ServerAddr}}" required>
+        </div>
+        <div class="form-group">
+            <label for="mountpoint">Mountpoint:</label>
+            <input type="text" id="mountpoint" name="mountpoint" value="{{.Config.Mountpoint}}" required>
+        </div>
+        <div class="form-group">
+            <label for="username">Username (optional):</label>
+            <input type="text" id="username" name="username" value="{{.Config.Username}}">
+            <small>Leave empty if no authentication required</small>
+        </div>
+        <div class="form-group">
+            <label for="password">Password (optional):</label>
+            <input type="password" id="password" name="password" value="{{.Config.Password}}">
+            <small>Leave empty if no authentication required</small>
+        </div>
+        <div class="form-group">
+            <label for="output">Output File:</label>
+            <input type="text" id="output" name="output" value="{{.Config.OutputFile}}" required>
+        </div>
+        <div class="form-group">
+            <label><input type="checkbox" name="save_default" value="1"> Save as default</label>
+            <label><input type="checkbox" name="save_password" value="1"> Include password (stored in plain text)</label>
+        </div>
+        <div class="button-group">
+            <button type="submit" id="start" name="action" value="start">Start New Session</button>
+        </div>
+    </form>
+    <div class="refresh-controls">
+        <button type="button" onclick="togglePause(this)">Pause Live Updates</button>
+    </div>
+    {{range .Sessions}}
+    <div class="session">
+        <h2>Session {{.ID}}: {{.Config.ServerAddr}}/{{.Config.Mountpoint}}</h2>
+        <div class="status">
+            <p>Client Status: <span id="status-{{.ID}}">{{.Status}}</span></p>
+            <p>Output File: {{.OutputFile}}</p>
+            <p><a href="/inspect?session={{.ID}}">Inspect decoded messages</a></p>
+            <form method="post">
+                <input type="hidden" name="session" value="{{.ID}}">
+                <button type="submit" id="restart-{{.ID}}" name="action" value="restart" {{if .IsRunning}}disabled{{end}}>Start</button>
+                <button type="submit" id="stop-{{.ID}}" name="action" value="stop" {{if not .IsRunning}}disabled{{end}}>Stop</button>
+                <button type="submit" id="remove-{{.ID}}" name="action" value="remove" {{if .IsRunning}}disabled{{end}}>Remove</button>
+            </form>
+        </div>
+        <h3>Base Station Position</h3>
+        <div class="{{if .Station}}station{{else}}station-missing{{end}}" id="station-{{.ID}}">
+            {{with .Station}}
+            <p>Message {{.Message}}, station ID {{.StationID}}</p>
+            <p>ECEF X/Y/Z: {{printf "%.4f" .X}} / {{printf "%.4f" .Y}} / {{printf "%.4f" .Z}} m</p>
+            <p>Lat/Lon: {{printf "%.8f" .Latitude}}, {{printf "%.8f" .Longitude}}</p>
+            <p>Ellipsoidal height: {{printf "%.3f" .Height}} m{{if eq .Message 1006}}, antenna height: {{printf "%.4f" .AntennaHeight}} m{{end}}</p>
+            {{else}}
+            <p>No 1005/1006 received yet. If this persists the base is probably not configured to transmit its position.</p>
+            {{end}}
+        </div>
+        <div class="message-types">
+            <h3>RTCM Message Types</h3>
+            <p>Bitrate: <span id="bitrate-{{.ID}}">{{.Bitrate}}</span> bit/s (10s average)</p>
+            <table>
+                <thead><tr><th>Type</th><th>Count</th></tr></thead>
+                <tbody id="msg-counts-{{.ID}}">
+                {{range .MsgCounts}}
+                <tr><td>{{.Type}}</td><td>{{.Count}}</td></tr>
+                {{end}}
+                </tbody>
+            </table>
+            <p id="no-counts-{{.ID}}" {{if .MsgCounts}}style="display:none"{{end}}>No RTCM messages decoded yet</p>
+        </div>
+        <div class="data-display">
+            <h3>RTCM Data (last {{$.BufferSize}} bytes)</h3>
+            <pre id="rtcm-data-{{.ID}}">{{.RTCMData}}</pre>
+            <p id="no-data-{{.ID}}" {{if .RTCMData}}style="display:none"{{end}}>No data received yet</p>
+        </div>
+    </div>
+    {{else}}
+    <p>No sessions yet, fill in the form and start one</p>
+    {{end}}
+    <div class="files-list">
+        <h3>Saved Files</h3>
+        {{range .Files}}
+        <div class="file-item">
+            <span>{{.}}</span>
+            <form method="post" style="display: inline;">
+                <input type="hidden" name="file" value="{{.}}">
+                <button type="submit" name="action" value="convert">Convert to Text</button>
+                <button type="submit" name="action" value="convert_gzip">Convert to Text (gzip)</button>
+                <button type="submit" name="action" value="download">Download</button>
+                <label><input type="checkbox" name="gzip" value="1"> gzip download</label>
+                <button type="submit" name="action" value="delete" onclick="return confirm('Delete {{.}}?')">Delete</button>
+            </form>
+        </div>
+        {{else}}
+        <p>No files saved yet</p>
+        {{end}}
+    </div>
+    <div class="message-types">
+        <h3>RTCM Errors</h3>
+        <p>CRC failures and data skipped while resynchronising. A steady stream of them points at the link, e.g. a bad serial cable or baud rate; skipped data at the very start or a stream with no frames at all is more likely a mountpoint sending something other than RTCM 3.</p>
+        <table>
+            <thead><tr><th>Time</th><th>Session</th><th>Offset</th><th>Error</th></tr></thead>
+            <tbody id="rtcm-errors">
+            {{range .RTCMErrors}}
+            <tr><td>{{.Time}}</td><td>{{.Session}}</td><td>{{.Offset}}</td><td>{{.Error}}</td></tr>
+            {{end}}
+            </tbody>
+        </table>
+        <p id="no-rtcm-errors" {{if .RTCMErrors}}style="display:none"{{end}}>No RTCM errors</p>
+    </div>
+    <div class="messages">
+        <h3>Recent Messages</h3>
+        <div id="messages">
+        {{range .Messages}}
+        <div class="message">{{.}}</div>
+        {{end}}
+        </div>
+    </div>
+</body>
+</html>
+`))
+	mutex.Lock()
+	defer mutex.Unlock()
+	pageData.Config = clientConfig
+	pageData.Sessions = views
+	pageData.Files = files
+	tmpl.Execute(w, pageData)
+}
+
+// handleSessionAction stops, restarts or removes a session from the page
+func handleSessionAction(action, id string) {
+	s, err := findSession(id)
+	if id == "" || err != nil {
+		addMessage(fmt.Sprintf("No session %q", id))
+		return
+	}
+	switch action {
+	case "stop":
+		s.stop()
+	case "restart":
+		s.start()
+	case "remove":
+		if err := removeSession(id); err != nil {
+			s.addMessage(fmt.Sprintf("Error removing session: %v", err))
+			return
+		}
+		addMessage(fmt.Sprintf("Removed session %s", id))
+		publish("sessions", nil)
+	}
+}
+
+func main() {
+	port := flag.Int("port", 8080, "Port to listen on")
+	flag.StringVar(&configPath, "config", "ntrip-web.yaml", "File the form defaults are saved to and loaded from")
+	authUser := flag.String("auth-user", "", "Require HTTP basic auth with this username")
+	authPassword := flag.String("auth-password", "", "Password for -auth-user (or set NTRIP_WEB_PASSWORD)")
+	flag.IntVar(&rtcmBufferSize, "buffer-size", rtcmBufferSize, "Bytes of RTCM data shown in each session's hex dump, e.g. 65536 when debugging")
+	caster := flag.String("caster-admin", "", "Admin address of an ntrip-server, e.g. 127.0.0.1:8081, to list and disconnect its clients at /caster")
+	flag.StringVar(&casterToken, "caster-token", os.Getenv("NTRIP_ADMIN_TOKEN"), "The caster's admin.token, needed to disconnect its clients (or set NTRIP_ADMIN_TOKEN)")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	flag.Parse()
+
+	if err := ntrip.SetupLogging(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Invalid logging flags: %v", err)
+	}
+	if rtcmBufferSize < 16 {
+		log.Fatalf("-buffer-size must be at least 16 bytes, got %d", rtcmBufferSize)
+	}
+
+	// Initialize default configuration, preferring the saved defaults
+	config, err := loadWebConfig(configPath, Config{
+		ServerAddr: "localhost:2101",
+		Mountpoint: "RTCM3",
+		OutputFile: "rtcm_data.bin",
+	})
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	clientConfig = config
+
+	// The address on the default route comes first
+	ips := localIPs()
+	pageData = PageData{
+		Config:        clientConfig,
+		Messages:      make([]string, 0),
+		ServerIP:      ips[0],
+		OtherIPs:      ips[1:],
+		MaxLines:      maxDumpLines(),
+		BufferSize:    rtcmBufferSize,
+		MaxRTCMErrors: maxRTCMErrors,
+		Caster:        *caster != "",
+	}
+	if *caster != "" {
+		casterAdmin = casterURL(*caster)
+		go pollCaster()
+	}
+
+	// Start web server
+	http.HandleFunc("/", handleRoot)
+	http.HandleFunc("/events", handleEvents)
+	http.HandleFunc("/inspect", handleInspect)
+	http.HandleFunc("/caster", handleCaster)
+	http.HandleFunc("/api/start", handleAPIStart)
+	http.HandleFunc("/api/stop", handleAPIStop)
+	http.HandleFunc("/api/status", handleAPIStatus)
+	http.HandleFunc("/api/sessions", handleAPISessions)
+	http.HandleFunc("/api/files", handleAPIFiles)
+
+	slog.Info("Starting web server", "url", "http://"+net.JoinHostPort(ips[0], strconv.Itoa(*port)), "other_addresses", ips[1:])
+
+	// Listen on all interfaces
+	handler := sameOrigin(http.DefaultServeMux)
+	if *authUser != "" {
+		password := cmp.Or(*authPassword, os.Getenv("NTRIP_WEB_PASSWORD"))
+		if password == "" {
+			log.Fatalf("-auth-user needs -auth-password or NTRIP_WEB_PASSWORD")
+		}
+		handler = requireAuth(handler, *authUser, password)
+	} else {
+		slog.Warn("Web interface has no authentication, set -auth-user to require a login")
+	}
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), handler))
+}
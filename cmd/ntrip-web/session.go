@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"ntrip"
+	"ntrip/rtcm"
+)
+
+// Session is one NTRIP client controlled from the web interface, with its
+// own configuration, capture file and live view. All fields are guarded by
+// mutex.
+type Session struct {
+	ID         string
+	Config     Config
+	Status     string
+	OutputFile string // Capture file of the current run
+
+	cancel    context.CancelFunc // Stops the running client
+	done      chan struct{}      // Closed once the running client returns
+	lines     []string           // Rolling hex dump of the RTCM data
+	dump      bytes.Buffer
+	dumper    io.WriteCloser
+	framer    *rtcm.Framer
+	errors    []rtcm.FrameError   // Rejected by framer, not yet published
+	counts    map[int]int         // Frames seen per message type
+	latest    map[int]lastMessage // Last frame of each type, for /inspect
+	bytesRecv int64               // Bytes received in the current run
+	client    *ntrip.Client       // Client of the current run
+	station   *StationView        // Last base position from 1005/1006
+}
+
+// StationView is a base station position decoded from 1005/1006
+type StationView struct {
+	Message   int     `json:"message"`
+	StationID int     `json:"station_id"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Z         float64 `json:"z"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Height    float64 `json:"height"`
+	// AntennaHeight above the marker, 1006 only
+	AntennaHeight float64 `json:"antenna_height"`
+}
+
+// newStationView decodes a station message, returning nil if it is invalid
+func newStationView(msg rtcm.Message) *StationView {
+	arp, err := rtcm.ParseStationARP(msg.Payload)
+	if err != nil {
+		return nil
+	}
+	lat, lon, height := arp.Geodetic()
+	return &StationView{
+		Message:       msg.Number,
+		StationID:     arp.StationID,
+		X:             arp.X,
+		Y:             arp.Y,
+		Z:             arp.Z,
+		Latitude:      lat,
+		Longitude:     lon,
+		Height:        height,
+		AntennaHeight: arp.Height,
+	}
+}
+
+// SessionView is the state of a session shown on the page
+type SessionView struct {
+	ID         string
+	Config     Config
+	Status     string
+	IsRunning  bool
+	OutputFile string
+	RTCMData   string
+	MsgCounts  []MessageCount
+	Station    *StationView
+	Bitrate    int
+}
+
+// DataEvent carries new hex dump lines of a session
+type DataEvent struct {
+	Session string
+	Lines   string
+}
+
+// StationEvent carries a changed base position of a session
+type StationEvent struct {
+	Session string
+	Station *StationView
+}
+
+// CountsEvent carries the message type counts and bitrate of a session
+type CountsEvent struct {
+	Session string
+	Counts  []MessageCount
+	Bitrate int
+}
+
+var (
+	sessions      = make(map[string]*Session) // Guarded by mutex
+	sessionOrder  []string                    // Session IDs in creation order
+	lastSessionID int
+)
+
+// newSession registers a stopped session for config
+func newSession(config Config) *Session {
+	mutex.Lock()
+	defer mutex.Unlock()
+	lastSessionID++
+	s := &Session{ID: strconv.Itoa(lastSessionID), Config: config, Status: "Client stopped"}
+	sessions[s.ID] = s
+	sessionOrder = append(sessionOrder, s.ID)
+	return s
+}
+
+// findSession returns the session with the given ID, or the most recently
+// created one when id is empty
+func findSession(id string) (*Session, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if id == "" && len(sessionOrder) > 0 {
+		id = sessionOrder[len(sessionOrder)-1]
+	}
+	s, ok := sessions[id]
+	if !ok {
+		return nil, errNoSession
+	}
+	return s, nil
+}
+
+// removeSession forgets a stopped session
+func removeSession(id string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		return errNoSession
+	}
+	if s.cancel != nil {
+		return errClientRunning
+	}
+	delete(sessions, id)
+	for i, sid := range sessionOrder {
+		if sid == id {
+			sessionOrder = append(sessionOrder[:i], sessionOrder[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// sessionViews snapshots every session for the page
+func sessionViews() []SessionView {
+	mutex.Lock()
+	defer mutex.Unlock()
+	views := make([]SessionView, 0, len(sessionOrder))
+	for _, id := range sessionOrder {
+		s := sessions[id]
+		views = append(views, SessionView{
+			ID:         s.ID,
+			Config:     s.Config,
+			Status:     s.Status,
+			IsRunning:  s.cancel != nil,
+			OutputFile: s.OutputFile,
+			RTCMData:   strings.Join(s.lines, ""),
+			MsgCounts:  sortedCounts(s.counts),
+			Station:    s.station,
+			Bitrate:    s.bitrate(),
+		})
+	}
+	return views
+}
+
+// setStatus records the session state and pushes it to the browser
+func (s *Session) setStatus(status string, running bool) {
+	mutex.Lock()
+	s.Status = status
+	mutex.Unlock()
+	publish("status", StatusEvent{Session: s.ID, Status: status, IsRunning: running})
+}
+
+// addMessage logs a message tagged with the session
+func (s *Session) addMessage(msg string) {
+	addMessage(fmt.Sprintf("Session %s: %s", s.ID, msg))
+}
+
+// reset clears the buffers and counters for a new client run. The caller
+// holds mutex.
+func (s *Session) reset() {
+	s.lines = nil
+	s.dump.Reset()
+	s.dumper = hex.Dumper(&s.dump)
+	s.framer = rtcm.NewFramer()
+	s.framer.OnError = func(fe rtcm.FrameError) { s.errors = append(s.errors, fe) }
+	s.errors = nil
+	s.counts = make(map[int]int)
+	s.latest = make(map[int]lastMessage)
+	s.bytesRecv = 0
+	s.station = nil
+}
+
+// record adds received data to the session's live view
+func (s *Session) record(data []byte) {
+	mutex.Lock()
+	s.bytesRecv += int64(len(data))
+	// Dump the new data, keeping any partial line for the next chunk
+	s.dumper.Write(data)
+	complete := bytes.LastIndexByte(s.dump.Bytes(), '\n') + 1
+	lines := string(s.dump.Next(complete))
+	s.lines = append(s.lines, strings.SplitAfter(lines, "\n")...)
+	if max := maxDumpLines(); len(s.lines) > max {
+		s.lines = s.lines[len(s.lines)-max:]
+	}
+
+	// Count decoded message types and track the base position
+	var station *StationView
+	now := time.Now()
+	for _, msg := range s.framer.Feed(data) {
+		s.counts[msg.Number]++
+		s.latest[msg.Number] = lastMessage{msg: msg, at: now}
+		if msg.Number != 1005 && msg.Number != 1006 {
+			continue
+		}
+		if sv := newStationView(msg); sv != nil && (s.station == nil || *sv != *s.station) {
+			s.station, station = sv, sv
+		}
+	}
+	counts := sortedCounts(s.counts)
+	bitrate := s.bitrate()
+	errors := s.errors
+	s.errors = nil
+	mutex.Unlock()
+
+	for _, fe := range errors {
+		addRTCMError(s.ID, fe)
+	}
+
+	if station != nil {
+		publish("station", StationEvent{Session: s.ID, Station: station})
+	}
+
+	if lines != "" {
+		publish("data", DataEvent{Session: s.ID, Lines: lines})
+	}
+	publish("counts", CountsEvent{Session: s.ID, Counts: counts, Bitrate: bitrate})
+}
+
+// bitrate returns the stream rate of the current or last run in bits per
+// second. The caller holds mutex.
+func (s *Session) bitrate() int {
+	if s.client == nil {
+		return 0
+	}
+	return s.client.Bitrate()
+}
+
+// start launches the session's NTRIP client. Two running sessions may not
+// write to the same output file.
+func (s *Session) start() error {
+	mutex.Lock()
+	if s.cancel != nil {
+		mutex.Unlock()
+		s.addMessage("Client already running")
+		return errClientRunning
+	}
+	for _, other := range sessions {
+		if other != s && other.cancel != nil && other.Config.OutputFile == s.Config.OutputFile {
+			mutex.Unlock()
+			s.addMessage(fmt.Sprintf("Output %s is in use by session %s", s.Config.OutputFile, other.ID))
+			return errOutputInUse
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.cancel, s.done = cancel, done
+	config := s.Config
+	s.reset()
+
+	client := ntrip.NewClient(config.ServerAddr, config.Mountpoint, config.Username, config.Password, config.OutputFile)
+	client.OutputFile = client.TimestampedName()
+	s.OutputFile = client.OutputFile
+	s.client = client
+	mutex.Unlock()
+	if config.Username != "" {
+		s.addMessage("Using authentication with username: " + config.Username)
+	}
+
+	// Receive the stream over a channel for the live view
+	data := make(chan []byte, 16)
+	client.Data = data
+	go func() {
+		for chunk := range data {
+			s.record(chunk)
+		}
+	}()
+
+	go func() {
+		defer close(done)
+		err := client.Run(ctx)
+		close(data)
+		if err != nil {
+			s.addMessage(fmt.Sprintf("Client error: %v", err))
+		}
+
+		mutex.Lock()
+		exited := s.done == done
+		if exited {
+			s.cancel, s.done = nil, nil
+		}
+		mutex.Unlock()
+		if exited {
+			s.setStatus("Client stopped", false)
+		}
+	}()
+
+	s.addMessage("Client started successfully")
+	s.addMessage(fmt.Sprintf("Connecting to %s, mountpoint: %s", config.ServerAddr, config.Mountpoint))
+
+	s.setStatus("Client started", true)
+	return nil
+}
+
+// stop stops the session's client and waits for it to exit
+func (s *Session) stop() error {
+	mutex.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	mutex.Unlock()
+
+	if cancel == nil {
+		s.addMessage("No client running")
+		return errClientStopped
+	}
+
+	cancel()
+	<-done
+
+	s.addMessage("Client stopped successfully")
+	s.setStatus("Client stopped", false)
+	return nil
+}
@@ -0,0 +1,207 @@
+package ntrip
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// commandStopTimeout is how long Close waits for the command to exit
+	// after closing its stdin before killing it
+	commandStopTimeout = 5 * time.Second
+	// maxCommandBackoff caps the delay between restarts of a failing
+	// command
+	maxCommandBackoff = time.Minute
+	// commandQueueSize is how many writes are queued for the command
+	commandQueueSize = 64
+)
+
+// CommandWriter feeds whatever is written to it to the stdin of a shell
+// command, like str2str's pipe output. A command that exits is restarted
+// on a later write, with exponential backoff. Writes are queued and fed
+// to the command in the background; data written while it is down, or
+// while the queue is full because it stopped reading, is dropped so the
+// stream to the other outputs never stalls.
+type CommandWriter struct {
+	command string
+	queue   chan []byte   // Nil until the first write
+	done    chan struct{} // Closed once feed has stopped the command
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	exited   chan struct{} // Closed once cmd has been reaped
+	started  time.Time
+	retryAt  time.Time
+	backoff  time.Duration
+	closed   bool
+	killed   bool // Close gave up waiting, the command is not restarted
+	dropping bool // The queue is full, logged once until it drains
+}
+
+// NewCommandWriter returns a writer for command, run with sh -c. The
+// command starts on the first write.
+func NewCommandWriter(command string) *CommandWriter {
+	return &CommandWriter{command: command, backoff: time.Second}
+}
+
+func (w *CommandWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("command %q is closed", w.command)
+	}
+	if w.queue == nil {
+		w.queue = make(chan []byte, commandQueueSize)
+		w.done = make(chan struct{})
+		go w.feed()
+	}
+	select {
+	case w.queue <- append([]byte(nil), p...):
+		w.dropping = false
+	default:
+		if !w.dropping {
+			slog.Warn("Command is not reading its input, dropping data", "command", w.command)
+			w.dropping = true
+		}
+	}
+	return len(p), nil
+}
+
+// feed writes the queued data to the command until Close, then stops it
+func (w *CommandWriter) feed() {
+	defer close(w.done)
+	for p := range w.queue {
+		w.write(p)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stop(commandStopTimeout)
+}
+
+// write passes p to the command, starting it first if it is not running.
+// Only the pipe write is made without holding mu, so Write never waits
+// for the command.
+func (w *CommandWriter) write(p []byte) {
+	w.mu.Lock()
+	if w.cmd != nil {
+		select {
+		case <-w.exited:
+			w.failed(fmt.Errorf("exited with %v", w.cmd.ProcessState))
+		default:
+		}
+	}
+	if w.cmd == nil {
+		if !w.killed && !time.Now().Before(w.retryAt) {
+			if err := w.start(); err != nil {
+				w.failed(err)
+			}
+		}
+		if w.cmd == nil {
+			w.mu.Unlock()
+			return
+		}
+	}
+	stdin := w.stdin
+	w.mu.Unlock()
+
+	_, err := stdin.Write(p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil && w.killed {
+		w.stop(0)
+		return
+	}
+	if err != nil {
+		w.failed(err)
+		return
+	}
+	// A command that ran for a while has recovered
+	if time.Since(w.started) >= stablePeriod {
+		w.backoff = time.Second
+	}
+}
+
+// start launches the command with its output going to ours. The caller
+// holds mu.
+func (w *CommandWriter) start() error {
+	cmd := exec.Command("sh", "-c", w.command)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	ownProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	w.cmd, w.stdin, w.exited, w.started = cmd, stdin, exited, time.Now()
+	slog.Info("Started command", "command", w.command, "pid", cmd.Process.Pid)
+	return nil
+}
+
+// failed drops the command after err and schedules the next start. The
+// caller holds mu.
+func (w *CommandWriter) failed(err error) {
+	slog.Warn("Command failed, restarting", "command", w.command, "err", err, "delay", w.backoff)
+	w.stop(0)
+	w.retryAt = time.Now().Add(w.backoff)
+	w.backoff = min(w.backoff*2, maxCommandBackoff)
+}
+
+// stop closes the command's stdin and waits up to timeout for it to exit
+// before killing it. The caller holds mu.
+func (w *CommandWriter) stop(timeout time.Duration) {
+	if w.cmd == nil {
+		return
+	}
+	w.stdin.Close()
+	select {
+	case <-w.exited:
+	case <-time.After(timeout):
+		killCommand(w.cmd)
+		<-w.exited
+	}
+	w.cmd, w.stdin, w.exited = nil, nil, nil
+}
+
+// Close lets the command finish the queued data and closes its stdin,
+// killing it if it has not exited within commandStopTimeout. A command
+// that stopped reading is killed once commandStopTimeout has passed.
+func (w *CommandWriter) Close() error {
+	w.mu.Lock()
+	if w.closed || w.queue == nil {
+		w.closed = true
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-time.After(commandStopTimeout):
+	}
+	w.mu.Lock()
+	w.killed = true
+	if w.cmd != nil {
+		killCommand(w.cmd)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
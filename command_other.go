@@ -0,0 +1,14 @@
+//go:build !unix
+
+package ntrip
+
+import "os/exec"
+
+// ownProcessGroup is not implemented here, the command shares the
+// client's signals
+func ownProcessGroup(cmd *exec.Cmd) {}
+
+// killCommand kills the shell running the command
+func killCommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,70 @@
+package ntrip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommandWriterDelivers(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	w := NewCommandWriter("cat > " + out)
+	var want []byte
+	for i := range 100 {
+		chunk := bytes.Repeat([]byte{byte(i)}, 100)
+		want = append(want, chunk...)
+		if n, err := w.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+		// Stay within the queue, the command is not under test here
+		if i%10 == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("command received %d bytes, %v, want %d", len(got), err, len(want))
+	}
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+// TestCommandWriterNeverReading feeds a command that never reads its
+// stdin and checks writes return at once and Close still stops it
+func TestCommandWriterNeverReading(t *testing.T) {
+	w := NewCommandWriter("sleep 60")
+	chunk := make([]byte, 4096)
+	w.Write(chunk)
+	waitFor(t, "the command to start", func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.cmd != nil
+	})
+	started := time.Now()
+	// Far more than the pipe and the queue hold
+	for range 1000 {
+		if n, err := w.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("writes took %v, blocked by the command", elapsed)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2*commandStopTimeout + 5*time.Second):
+		t.Fatal("Close did not stop a command that never reads")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package ntrip
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup keeps terminal signals such as Ctrl-C from reaching the
+// command directly, so it gets to drain its stdin when the client stops
+func ownProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killCommand kills the command's whole process group, so programs the
+// shell started go too
+func killCommand(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
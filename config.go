@@ -0,0 +1,430 @@
+package ntrip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultPort             = 2101    // Standard NTRIP port
+	defaultClientBufferSize = 64      // Queued chunks per client
+	defaultMountpoint       = "RTCM3" // Served when no mountpoints are configured
+	defaultSource           = "serial"
+	defaultBanner           = "NTRIP Caster"
+
+	defaultDrainTimeout         = 30 // seconds
+	defaultWriteTimeout         = 10 // seconds
+	defaultReconnectInterval    = 1  // seconds
+	defaultMaxReconnectInterval = 30 // seconds
+	defaultSourceBufferSize     = 64 * 1024
+	defaultReadBufferSize       = 4096 // bytes per read from a source or client
+)
+
+// Slow client policies applied when a client's write queue is full
+const (
+	policyDrop       = "drop"
+	policyDisconnect = "disconnect"
+)
+
+// Config is the caster configuration loaded from YAML
+type Config struct {
+	Server struct {
+		Port int `yaml:"port"`
+		// Host is the bind address, or unix:/path/to.sock to listen on a
+		// UNIX socket instead of the TCP port
+		Host             string `yaml:"host"`
+		Timeout          int    `yaml:"timeout"`
+		ClientBufferSize int    `yaml:"client_buffer_size"`
+		SlowClientPolicy string `yaml:"slow_client_policy"`
+		// KeepaliveInterval in seconds, 0 disables keepalives
+		KeepaliveInterval int `yaml:"keepalive_interval"`
+		// TCPKeepalive is the TCP keepalive period for client connections
+		// in seconds, detecting dead rovers at the socket level. 0 keeps
+		// Go's default of 15s and -1 disables keepalives.
+		TCPKeepalive int `yaml:"tcp_keepalive"`
+		// WriteTimeout bounds each write to a client in seconds, so a rover
+		// whose TCP window stays full cannot hold its writer forever. 0
+		// uses defaultWriteTimeout and -1 disables the deadline. Under the
+		// drop policy a client is disconnected once maxWriteStalls
+		// deadlines pass in a row without a byte written.
+		WriteTimeout int `yaml:"write_timeout"`
+		// ReadBufferSize is the most read from a client connection in one
+		// call, such as the GGA sentences of VRS rovers, 0 for
+		// defaultReadBufferSize
+		ReadBufferSize int `yaml:"read_buffer_size"`
+		// DrainTimeout is how long a drain waits, in seconds, for clients
+		// to reach a frame boundary before closing them
+		DrainTimeout int `yaml:"drain_timeout"`
+		// Banner names the caster in the Server header of every response,
+		// followed by "/" and the build version
+		Banner string `yaml:"banner"`
+		// Chunked frames the NTRIP v2 stream with chunked transfer
+		// encoding. Otherwise the body is unframed and ends when the
+		// connection closes.
+		Chunked bool `yaml:"chunked"`
+		// MaxClients caps concurrent connections, MaxClientsPerIP caps
+		// them per remote address. 0 means unlimited.
+		MaxClients      int `yaml:"max_clients"`
+		MaxClientsPerIP int `yaml:"max_clients_per_ip"`
+		// TLS serves the caster over TLS when a certificate is set. With
+		// Port set too, TLS is served there and plaintext stays on Port.
+		TLS struct {
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+			Port     int    `yaml:"port"`
+		} `yaml:"tls"`
+		// Users maps usernames to a bcrypt hash or plaintext password
+		Users map[string]string `yaml:"users"`
+		// Responses picks the status line sent to NTRIP v1 clients by
+		// User-Agent, ahead of the built-in table
+		Responses []ResponseRule `yaml:"responses"`
+	} `yaml:"server"`
+	// Serial is the default source, referred to as "serial" by mountpoints
+	Serial      SerialConfig       `yaml:"serial"`
+	Sources     []SourceConfig     `yaml:"sources"`
+	Mountpoints []MountpointConfig `yaml:"mountpoints"`
+	SourceTable []StreamInfo       `yaml:"sourcetable"`
+	Admin       struct {
+		// Addr is the listen address of the admin HTTP server, which is
+		// disabled when empty
+		Addr string `yaml:"addr"`
+		// Token, when set, must be sent as "Authorization: Bearer <token>"
+		// to disconnect clients
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
+	Metrics struct {
+		// Addr is the listen address of the Prometheus /metrics endpoint,
+		// disabled when empty. The same address as admin.addr serves both
+		// from one listener.
+		Addr string `yaml:"addr"`
+	} `yaml:"metrics"`
+	Logging struct {
+		// Level is debug, info, warn or error
+		Level string `yaml:"level"`
+		// Format is text or json
+		Format string `yaml:"format"`
+	} `yaml:"logging"`
+	// Authentication is the legacy single user setting, merged into
+	// server.users when enabled
+	Authentication struct {
+		Enabled  bool   `yaml:"enabled"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"authentication"`
+}
+
+// SerialConfig configures a source. Despite the name it also covers
+// receivers streaming over TCP and upstream casters, selected with Type.
+type SerialConfig struct {
+	// Type is "serial" (the default), "tcp", "ntrip" or "file"
+	Type string `yaml:"type"`
+	// Address is the host:port of a tcp source
+	Address string `yaml:"address"`
+	// Path is the RTCM capture replayed by a file source, from the start
+	// again at its end with Loop. Rate paces the replay to that many
+	// epochs per second, 0 reads the file as fast as clients take it.
+	Path string  `yaml:"path"`
+	Loop bool    `yaml:"loop"`
+	Rate float64 `yaml:"rate"`
+	// Timestamped reads Path as a capture written by the client with
+	// -timestamped. Realtime replays it at the arrival times of its
+	// records instead of pacing it by Rate.
+	Timestamped bool `yaml:"timestamped"`
+	Realtime    bool `yaml:"realtime"`
+	// Upstream is the caster an ntrip source relays
+	Upstream             UpstreamConfig `yaml:"upstream"`
+	Port                 string         `yaml:"port"`
+	BaudRate             int            `yaml:"baud_rate"`
+	DataBits             int            `yaml:"data_bits"`
+	StopBits             int            `yaml:"stop_bits"`
+	Parity               string         `yaml:"parity"`
+	ReconnectInterval    int            `yaml:"reconnect_interval"`
+	MaxReconnectInterval int            `yaml:"max_reconnect_interval"`
+	// WaitForPort starts the server even if the source can't be opened
+	// yet, retrying it in the background while clients are served an
+	// empty stream
+	WaitForPort bool `yaml:"wait_for_port"`
+	// BufferSize is the bytes buffered between reading the source and
+	// sending to clients, absorbing bursts while clients are written to
+	BufferSize int `yaml:"buffer_size"`
+	// ReadBufferSize is the most read from the source in one call, 0 for
+	// defaultReadBufferSize. Larger reads mean fewer syscalls on fast
+	// feeds.
+	ReadBufferSize int `yaml:"read_buffer_size"`
+	// DataTimeout, in seconds, flags the source as unhealthy when it sends
+	// nothing for that long, 0 disables the check. DisconnectOnSilence
+	// then also drops the clients of its mountpoints so rovers can fail
+	// over to another caster.
+	DataTimeout         int  `yaml:"data_timeout"`
+	DisconnectOnSilence bool `yaml:"disconnect_on_silence"`
+	// OnDemand connects the source only while its mountpoints have
+	// clients, such as an ntrip source relaying a caster that bills per
+	// connection
+	OnDemand bool `yaml:"on_demand"`
+	// SplitNMEA forwards only the RTCM frames of a feed mixing RTCM and
+	// NMEA, as receivers do on one serial line. The NMEA sentences are
+	// appended to NMEALog if set, else logged at debug level, and the
+	// last GGA position is reported in the stats.
+	SplitNMEA bool   `yaml:"split_nmea"`
+	NMEALog   string `yaml:"nmea_log"`
+}
+
+// ResponseRule sends Response, "icy" or "http", to NTRIP v1 clients whose
+// User-Agent contains Agent, ignoring case
+type ResponseRule struct {
+	Agent    string `yaml:"agent"`
+	Response string `yaml:"response"`
+}
+
+// UpstreamConfig is the caster mountpoint relayed by an ntrip source
+type UpstreamConfig struct {
+	ServerAddr string `yaml:"server_addr"`
+	Mountpoint string `yaml:"mountpoint"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	// Version is the NTRIP protocol version to request, 1 or 2
+	Version int `yaml:"ntrip_version"`
+}
+
+// SourceConfig is a named feed that mountpoints can refer to
+type SourceConfig struct {
+	Name         string `yaml:"name"`
+	SerialConfig `yaml:",inline"`
+}
+
+// MountpointConfig maps a requested mountpoint to the source feeding it
+type MountpointConfig struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Enabled     *bool  `yaml:"enabled"`
+	Source      string `yaml:"source"`
+	// Users restricts the mountpoint to the listed users, any configured
+	// user may connect when empty
+	Users []string `yaml:"users"`
+	// AllowTypes forwards only these RTCM message numbers, DenyTypes
+	// forwards everything but them. At most one of the two may be set.
+	AllowTypes []int `yaml:"allow_types"`
+	DenyTypes  []int `yaml:"deny_types"`
+	// PrimeOnConnect sends new clients the latest 1005/1006, 1033 and 1230
+	// messages right after the header, so rovers need not wait for the
+	// next broadcast of the base position
+	PrimeOnConnect bool `yaml:"prime_on_connect"`
+}
+
+// configFetchTimeout bounds fetching a configuration URL
+const configFetchTimeout = 30 * time.Second
+
+// readConfig returns the raw configuration from stdin, a URL or a file
+func readConfig(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		return os.ReadFile(path)
+	}
+
+	client := http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// enabled reports whether the mountpoint should be served, mountpoints
+// are enabled unless explicitly turned off
+func (m MountpointConfig) enabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// LoadConfig reads a YAML configuration and validates it. Settings are
+// layered with later ones winning: the file, then NTRIP_* environment
+// variables, then the given overrides such as those from ConfigFlags. The
+// path may be "-" for stdin or an http(s) URL to fetch. An empty path
+// starts from an empty configuration instead of a file.
+func LoadConfig(path string, overrides ...func(*Config) error) (Config, error) {
+	var config Config
+	if path != "" {
+		data, err := readConfig(path)
+		if err != nil {
+			return config, fmt.Errorf("error reading config file: %v", err)
+		}
+
+		err = yaml.Unmarshal(data, &config)
+		if err != nil {
+			return config, fmt.Errorf("error parsing config file: %v", err)
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return config, err
+	}
+	for _, override := range overrides {
+		if err := override(&config); err != nil {
+			return config, err
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config:\n%v", err)
+	}
+
+	return config, nil
+}
+
+// Validate checks the configuration for values that would only fail
+// later at startup, reporting every problem found at once
+func (c Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d is outside 1-65535, or 0 for the default %d", c.Server.Port, defaultPort))
+	}
+	if c.Server.TCPKeepalive < -1 {
+		errs = append(errs, fmt.Errorf("server.tcp_keepalive must be -1, 0 or a period in seconds, got %d", c.Server.TCPKeepalive))
+	}
+	if c.Server.WriteTimeout < -1 {
+		errs = append(errs, fmt.Errorf("server.write_timeout must be -1, 0 or a timeout in seconds, got %d", c.Server.WriteTimeout))
+	}
+	if c.Server.DrainTimeout < 0 {
+		errs = append(errs, fmt.Errorf("server.drain_timeout must not be negative, got %d", c.Server.DrainTimeout))
+	}
+	if c.Server.ReadBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("server.read_buffer_size must not be negative, got %d", c.Server.ReadBufferSize))
+	}
+	switch c.Server.SlowClientPolicy {
+	case "", policyDrop, policyDisconnect:
+	default:
+		errs = append(errs, fmt.Errorf("server.slow_client_policy %q must be %q or %q", c.Server.SlowClientPolicy, policyDrop, policyDisconnect))
+	}
+	for i, rule := range c.Server.Responses {
+		if rule.Response != responseICY && rule.Response != responseHTTP {
+			errs = append(errs, fmt.Errorf("server.responses[%d]: response must be %q or %q, got %q", i, responseICY, responseHTTP, rule.Response))
+		}
+	}
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("server.tls needs both cert_file and key_file"))
+	}
+	if tls.Port < 0 || tls.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.tls.port %d is outside 1-65535, or 0 to serve TLS on server.port", tls.Port))
+	}
+	if path, ok := unixSocket(c.Server.Host); ok {
+		if path == "" {
+			errs = append(errs, fmt.Errorf("server.host %q has no socket path", c.Server.Host))
+		}
+		if tls.CertFile != "" || tls.KeyFile != "" {
+			errs = append(errs, fmt.Errorf("server.tls is not supported on a UNIX socket"))
+		}
+	}
+
+	// The default source only matters when a mountpoint uses it
+	sources := map[string]bool{defaultSource: true}
+	usesDefault := len(c.Mountpoints) == 0
+	for _, mc := range c.Mountpoints {
+		if mc.enabled() && (mc.Source == "" || mc.Source == defaultSource) {
+			usesDefault = true
+		}
+	}
+	if usesDefault {
+		errs = append(errs, c.Serial.validate("serial")...)
+	}
+	for i, sc := range c.Sources {
+		if sc.Name == "" {
+			errs = append(errs, fmt.Errorf("sources[%d] has no name", i))
+			continue
+		}
+		if sources[sc.Name] {
+			errs = append(errs, fmt.Errorf("source %q is defined more than once", sc.Name))
+		}
+		sources[sc.Name] = true
+		errs = append(errs, sc.SerialConfig.validate("source "+sc.Name)...)
+	}
+
+	names := make(map[string]bool)
+	for i, mc := range c.Mountpoints {
+		if mc.Name == "" {
+			errs = append(errs, fmt.Errorf("mountpoints[%d] has no name", i))
+			continue
+		}
+		if names[mc.Name] {
+			errs = append(errs, fmt.Errorf("mountpoint %q is defined more than once", mc.Name))
+		}
+		names[mc.Name] = true
+		if mc.Source != "" && !sources[mc.Source] {
+			errs = append(errs, fmt.Errorf("mountpoint %q refers to unknown source %q", mc.Name, mc.Source))
+		}
+		if len(mc.AllowTypes) > 0 && len(mc.DenyTypes) > 0 {
+			errs = append(errs, fmt.Errorf("mountpoint %q sets both allow_types and deny_types", mc.Name))
+		}
+		for _, n := range append(append([]int(nil), mc.AllowTypes...), mc.DenyTypes...) {
+			if n < 1 || n > 4095 {
+				errs = append(errs, fmt.Errorf("mountpoint %q has invalid RTCM message type %d", mc.Name, n))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the settings of one source, named in the errors by what.
+// An empty serial port is allowed and means the port is auto-detected.
+func (sc SerialConfig) validate(what string) []error {
+	var errs []error
+	switch sc.Type {
+	case "", "serial":
+		if sc.BaudRate <= 0 {
+			errs = append(errs, fmt.Errorf("%s: baud_rate must be positive, got %d", what, sc.BaudRate))
+		}
+		if sc.DataBits < 5 || sc.DataBits > 8 {
+			errs = append(errs, fmt.Errorf("%s: data_bits must be 5, 6, 7 or 8, got %d", what, sc.DataBits))
+		}
+		if sc.StopBits != 1 && sc.StopBits != 2 {
+			errs = append(errs, fmt.Errorf("%s: stop_bits must be 1 or 2, got %d", what, sc.StopBits))
+		}
+		if sc.Parity != "N" && sc.Parity != "E" && sc.Parity != "O" {
+			errs = append(errs, fmt.Errorf("%s: parity must be N, E or O, got %q", what, sc.Parity))
+		}
+	case "tcp":
+		if sc.Address == "" {
+			errs = append(errs, fmt.Errorf("%s: tcp sources need an address", what))
+		}
+	case "ntrip":
+		if sc.Upstream.ServerAddr == "" || sc.Upstream.Mountpoint == "" {
+			errs = append(errs, fmt.Errorf("%s: ntrip sources need upstream.server_addr and upstream.mountpoint", what))
+		}
+	case "file":
+		if sc.Path == "" {
+			errs = append(errs, fmt.Errorf("%s: file sources need a path", what))
+		}
+		if sc.Rate < 0 {
+			errs = append(errs, fmt.Errorf("%s: rate must not be negative, got %v", what, sc.Rate))
+		}
+		if sc.Realtime && (!sc.Timestamped || sc.Rate > 0) {
+			errs = append(errs, fmt.Errorf("%s: realtime needs a timestamped capture and no rate", what))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: type must be serial, tcp, ntrip or file, got %q", what, sc.Type))
+	}
+	if sc.DataTimeout < 0 {
+		errs = append(errs, fmt.Errorf("%s: data_timeout must not be negative, got %d", what, sc.DataTimeout))
+	}
+	if sc.BufferSize < 0 {
+		errs = append(errs, fmt.Errorf("%s: buffer_size must not be negative, got %d", what, sc.BufferSize))
+	}
+	if sc.ReadBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("%s: read_buffer_size must not be negative, got %d", what, sc.ReadBufferSize))
+	}
+	if sc.NMEALog != "" && !sc.SplitNMEA {
+		errs = append(errs, fmt.Errorf("%s: nmea_log needs split_nmea", what))
+	}
+	return errs
+}
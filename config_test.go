@@ -0,0 +1,50 @@
+package ntrip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    int
+		tlsPort int
+		err     string // Expected error, empty when the ports are valid
+	}{
+		{name: "default port", port: 0},
+		{name: "standard port", port: 2101},
+		{name: "highest port", port: 65535},
+		{name: "negative", port: -1, err: "server.port -1 is outside 1-65535, or 0 for the default 2101"},
+		{name: "too high", port: 65536, err: "server.port 65536 is outside 1-65535"},
+		{name: "TLS on the port", port: 2101, tlsPort: 0},
+		{name: "separate TLS port", port: 2101, tlsPort: 2102},
+		{name: "TLS too high", port: 2101, tlsPort: 70000, err: "server.tls.port 70000 is outside 1-65535, or 0 to serve TLS on server.port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Serial = SerialConfig{Type: "tcp", Address: "localhost:5000"}
+			config.Server.Port = tt.port
+			config.Server.TLS.Port = tt.tlsPort
+			err := config.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestDefaultPort checks that port 0 is the one Validate promises
+func TestDefaultPort(t *testing.T) {
+	var config Config
+	if s := NewServer(config); s.port != defaultPort {
+		t.Errorf("port %d for server.port 0, want %d", s.port, defaultPort)
+	}
+}
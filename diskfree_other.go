@@ -0,0 +1,8 @@
+//go:build !unix
+
+package ntrip
+
+// diskFree is not implemented here, so the free space guard never trips
+func diskFree(dir string) (int64, bool) {
+	return 0, false
+}
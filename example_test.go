@@ -0,0 +1,59 @@
+package ntrip_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"ntrip"
+	"ntrip/rtcm"
+)
+
+// Stream hands the caster's RTCM stream to any io.Writer, here standard
+// output, until the connection drops or the program is interrupted.
+func ExampleClient_Stream() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := ntrip.NewClient("caster.example.com:2101", "RTCM3", "user", "password", "")
+	c.Version = ntrip.NtripV2
+	stream, err := c.Stream(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stream.Close()
+
+	if _, err := io.Copy(os.Stdout, stream); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+// Messages delivers the stream already framed, so messages can be routed
+// by type. The channel is requested before Run, which closes it once the
+// client stops.
+func ExampleClient_Messages() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := ntrip.NewClient("caster.example.com:2101", "RTCM3", "user", "password", "")
+	msgs := c.Messages()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range msgs {
+			switch {
+			case msg.Number == 1005 || msg.Number == 1006:
+				log.Printf("station %d position", msg.StationID)
+			case rtcm.IsMSM(msg.Number):
+				log.Printf("MSM %d, %d bytes, at %v", msg.Number, len(msg.Payload), msg.Received)
+			}
+		}
+	}()
+
+	if err := c.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	<-done
+}
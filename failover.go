@@ -0,0 +1,50 @@
+package ntrip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Endpoint is a caster mountpoint the client can fail over to
+type Endpoint struct {
+	ServerAddr string
+	Mountpoint string
+	Username   string
+	Password   string
+}
+
+func (e Endpoint) String() string {
+	return e.ServerAddr + "/" + e.Mountpoint
+}
+
+// ParseEndpoints parses a comma-separated list of
+// server[:port]/mountpoint[/user:pass] endpoints
+func ParseEndpoints(list string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "/", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid endpoint %q, want server/mountpoint[/user:pass]", item)
+		}
+		e := Endpoint{ServerAddr: parts[0], Mountpoint: parts[1]}
+		if len(parts) == 3 {
+			e.Username, e.Password, _ = strings.Cut(parts[2], ":")
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+// endpoint returns the caster the client is configured for
+func (c *Client) endpoint() Endpoint {
+	return Endpoint{ServerAddr: c.ServerAddr, Mountpoint: c.Mountpoint, Username: c.Username, Password: c.Password}
+}
+
+// use points the client at e
+func (c *Client) use(e Endpoint) {
+	c.ServerAddr, c.Mountpoint, c.Username, c.Password = e.ServerAddr, e.Mountpoint, e.Username, e.Password
+}
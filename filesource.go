@@ -0,0 +1,180 @@
+package ntrip
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// fileSource replays a captured RTCM file as if it were a live feed. With
+// a rate the file is reframed and paced by observation epoch, dropping
+// bytes outside RTCM frames. Without loop the source goes quiet at the end
+// of the file until it is closed. A timestamped capture is read record by
+// record, in realtime at the arrival times of the records.
+type fileSource struct {
+	f      *os.File
+	loop   bool
+	delay  time.Duration // Pause before each epoch, 0 reads unpaced
+	closed chan struct{}
+	read   int64 // Bytes read since the file was last rewound
+
+	records  *RecordReader // Nil for a raw capture
+	realtime bool
+	record   []byte    // Rest of the record being returned
+	lastTime time.Time // Arrival time of the previous record
+
+	framer    *rtcm.Framer
+	queue     []rtcm.Message // Frames read ahead of the pending one
+	pending   []byte         // Rest of the frame being returned
+	epoch     uint32         // Epoch time of the last observation message
+	haveEpoch bool           // Whether the file has observation messages
+}
+
+// openFile opens the capture replayed by a file source
+func openFile(src *source) (io.ReadCloser, error) {
+	if src.config.Path == "" {
+		return nil, fmt.Errorf("no path configured for file source %s", src.name)
+	}
+	f, err := os.Open(src.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", src.config.Path, err)
+	}
+	fs := &fileSource{f: f, loop: src.config.Loop, closed: make(chan struct{})}
+	if src.config.Rate > 0 {
+		fs.delay = time.Duration(float64(time.Second) / src.config.Rate)
+		fs.framer = rtcm.NewFramer()
+	}
+	if src.config.Timestamped {
+		fs.records = NewRecordReader(f)
+		fs.realtime = src.config.Realtime
+	}
+	slog.Info("Replaying file source", "source", src.name, "path", src.config.Path, "loop", fs.loop, "rate", src.config.Rate,
+		"timestamped", src.config.Timestamped, "realtime", fs.realtime)
+	return fs, nil
+}
+
+func (fs *fileSource) Read(p []byte) (int, error) {
+	if fs.delay == 0 {
+		return fs.readFile(p)
+	}
+	for len(fs.pending) == 0 {
+		if len(fs.queue) == 0 {
+			buf := make([]byte, 4096)
+			n, err := fs.readFile(buf)
+			if err != nil {
+				return 0, err
+			}
+			fs.queue = fs.framer.Feed(buf[:n])
+			continue
+		}
+		msg := fs.queue[0]
+		fs.queue = fs.queue[1:]
+		if fs.newEpoch(msg) {
+			select {
+			case <-fs.closed:
+				return 0, io.EOF
+			case <-time.After(fs.delay):
+			}
+		}
+		fs.pending = msg.Frame
+	}
+	n := copy(p, fs.pending)
+	fs.pending = fs.pending[n:]
+	return n, nil
+}
+
+// newEpoch reports whether msg starts a new epoch. Once the file has shown
+// observation messages only their epoch times count, before that every
+// frame is an epoch of its own.
+func (fs *fileSource) newEpoch(msg rtcm.Message) bool {
+	ms, _, ok := rtcm.EpochTime(msg.Payload)
+	if !ok {
+		return !fs.haveEpoch
+	}
+	changed := !fs.haveEpoch || ms != fs.epoch
+	fs.epoch, fs.haveEpoch = ms, true
+	return changed
+}
+
+// readFile reads the file, starting over at the end when looping
+func (fs *fileSource) readFile(p []byte) (int, error) {
+	if fs.records != nil {
+		return fs.readRecords(p)
+	}
+	n, err := fs.f.Read(p)
+	fs.read += int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+	return n, fs.rewind()
+}
+
+// readRecords returns the stream data of a timestamped capture, waiting
+// out the gaps between records in realtime
+func (fs *fileSource) readRecords(p []byte) (int, error) {
+	for len(fs.record) == 0 {
+		rec, err := fs.records.Next()
+		if err == io.ErrUnexpectedEOF {
+			// The capture was cut short mid-record, as by a crash
+			slog.Warn("Timestamped capture ends in a partial record", "path", fs.f.Name())
+			err = io.EOF
+		}
+		if err == io.EOF {
+			if err := fs.rewind(); err != nil {
+				return 0, err
+			}
+			fs.records = NewRecordReader(fs.f)
+			fs.lastTime = time.Time{}
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %v", fs.f.Name(), err)
+		}
+		fs.read += int64(recordHeaderLen + len(rec.Data))
+		if fs.realtime && !fs.lastTime.IsZero() {
+			select {
+			case <-fs.closed:
+				return 0, io.EOF
+			case <-time.After(rec.Time.Sub(fs.lastTime)):
+			}
+		}
+		fs.lastTime = rec.Time
+		fs.record = rec.Data
+	}
+	n := copy(p, fs.record)
+	fs.record = fs.record[n:]
+	return n, nil
+}
+
+// rewind starts the file over at its end when looping. Otherwise it waits
+// for the source to be closed and returns io.EOF.
+func (fs *fileSource) rewind() error {
+	if !fs.loop {
+		slog.Info("File source finished", "path", fs.f.Name())
+		<-fs.closed
+		return io.EOF
+	}
+	if fs.read == 0 {
+		return fmt.Errorf("%s is empty", fs.f.Name())
+	}
+	if _, err := fs.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	slog.Debug("Replaying file from the start", "path", fs.f.Name())
+	fs.read = 0
+	return nil
+}
+
+// Close stops the replay, unblocking a pending Read
+func (fs *fileSource) Close() error {
+	select {
+	case <-fs.closed:
+	default:
+		close(fs.closed)
+	}
+	return fs.f.Close()
+}
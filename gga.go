@@ -0,0 +1,92 @@
+package ntrip
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nmeaChecksum returns the XOR checksum of the sentence body between '$'
+// and '*'
+func nmeaChecksum(body string) byte {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return sum
+}
+
+// ReadGGAFile returns the last GGA sentence in a file kept up to date by
+// another process, such as a rover's position logger. The sentence must
+// carry a valid checksum, a file caught mid-write is rejected rather than
+// sent.
+func ReadGGAFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(string(data), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if len(line) < 6 || line[0] != '$' || line[3:6] != "GGA" {
+			continue
+		}
+		body, sum, ok := strings.Cut(line[1:], "*")
+		if !ok || !strings.EqualFold(sum, fmt.Sprintf("%02X", nmeaChecksum(body))) {
+			return "", fmt.Errorf("bad checksum in %s: %s", path, line)
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("no GGA sentence in %s", path)
+}
+
+// GGASentence returns the GGA sentence to send. A literal sentence has
+// its checksum filled in or corrected, coordinates are turned into a
+// sentence stamped with the given time.
+func GGASentence(gga string, now time.Time) (string, error) {
+	gga = strings.TrimSpace(gga)
+	if strings.HasPrefix(gga, "$") {
+		body, _, _ := strings.Cut(gga[1:], "*")
+		// The sentence type follows the two character talker ID
+		if len(body) < 5 || body[2:5] != "GGA" {
+			return "", fmt.Errorf("not a GGA sentence: %s", gga)
+		}
+		return fmt.Sprintf("$%s*%02X", body, nmeaChecksum(body)), nil
+	}
+
+	parts := strings.Split(gga, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("invalid GGA position %q, expected lat,lon[,alt]", gga)
+	}
+	var coords [3]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid GGA position %q: %v", gga, err)
+		}
+		coords[i] = v
+	}
+	lat, lon, alt := coords[0], coords[1], coords[2]
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return "", fmt.Errorf("GGA position out of range: %s", gga)
+	}
+
+	latHemi, lonHemi := "N", "E"
+	if lat < 0 {
+		latHemi, lat = "S", -lat
+	}
+	if lon < 0 {
+		lonHemi, lon = "W", -lon
+	}
+	latDeg, lonDeg := math.Floor(lat), math.Floor(lon)
+
+	body := fmt.Sprintf("GPGGA,%s,%02.0f%08.5f,%s,%03.0f%08.5f,%s,1,12,1.0,%.3f,M,0.0,M,,",
+		now.UTC().Format("150405.00"),
+		latDeg, (lat-latDeg)*60, latHemi,
+		lonDeg, (lon-lonDeg)*60, lonHemi,
+		alt)
+	return fmt.Sprintf("$%s*%02X", body, nmeaChecksum(body)), nil
+}
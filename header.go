@@ -0,0 +1,74 @@
+package ntrip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultUserAgent is sent when the client has no UserAgent, naming the
+// build like the caster's Server header
+func defaultUserAgent() string {
+	return "NTRIP/" + Version
+}
+
+// Header is an extra request header sent by the client
+type Header struct {
+	Name  string
+	Value string
+}
+
+// reservedHeaders are set by the client itself and are only replaced by a
+// custom header when explicitly allowed
+var reservedHeaders = []string{"Host", "Authorization", "Ntrip-Version", "User-Agent", "Connection"}
+
+// ParseHeader parses a "Name: value" header for Client.Headers. Reserved
+// headers the client sets itself, such as Authorization, are rejected
+// unless allowReserved is set, in which case they replace the built-in
+// one.
+func ParseHeader(s string, allowReserved bool) (Header, error) {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return Header{}, fmt.Errorf("invalid header %q, want \"Name: value\"", s)
+	}
+	h := Header{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)}
+	if h.Name == "" || strings.IndexFunc(h.Name, func(r rune) bool { return !isTokenChar(r) }) >= 0 {
+		return Header{}, fmt.Errorf("invalid header name %q", h.Name)
+	}
+	if strings.ContainsAny(h.Value, "\r\n") {
+		return Header{}, fmt.Errorf("invalid value for header %s", h.Name)
+	}
+	if h.reserved() && !allowReserved {
+		return Header{}, fmt.Errorf("header %s is set by the client, allow reserved headers to replace it", h.Name)
+	}
+	return h, nil
+}
+
+// reserved reports whether the header replaces one the client sets itself
+func (h Header) reserved() bool {
+	for _, name := range reservedHeaders {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTokenChar reports whether r may appear in an HTTP header name
+func isTokenChar(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return r < 0x80 && strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// overrides reports whether a custom header replaces the built-in header
+// name
+func (c *Client) overrides(name string) bool {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package ntrip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// SetupLogging installs the default logger, writing to stderr at the
+// given level ("debug", "info", "warn" or "error") as "text" or "json"
+func SetupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+
+	var h slog.Handler
+	switch format {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// repeatLogInterval is how often an error that keeps repeating is logged
+const repeatLogInterval = time.Minute
+
+// repeatLog keeps an error that repeats, like reads from an unplugged
+// receiver, from flooding the log. The first occurrence is logged, then
+// at most one "still failing" line per repeatLogInterval with the count.
+type repeatLog struct {
+	mu      sync.Mutex
+	key     string // Message and error of the current run
+	times   int    // Occurrences in the current run
+	lastLog time.Time
+}
+
+// log logs msg with err at level, unless it repeats the last error within
+// repeatLogInterval of it being logged
+func (r *repeatLog) log(level slog.Level, msg string, err error, args ...any) {
+	key := msg + ": " + err.Error()
+	now := time.Now()
+	r.mu.Lock()
+	if key != r.key {
+		r.key, r.times, r.lastLog = key, 1, now
+		r.mu.Unlock()
+		slog.Log(context.Background(), level, msg, append(args, "err", err)...)
+		return
+	}
+	r.times++
+	if now.Sub(r.lastLog) < repeatLogInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastLog = now
+	times := r.times
+	r.mu.Unlock()
+	slog.Log(context.Background(), level, msg+", still failing", append(args, "err", err, "times", times)...)
+}
+
+// reset ends the current run once the operation succeeds, so the next
+// error is logged at once
+func (r *repeatLog) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.key, r.times = "", 0
+}
@@ -0,0 +1,157 @@
+package ntrip
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// ReceivedMessage is an RTCM message delivered by Client.Messages
+type ReceivedMessage struct {
+	rtcm.Message
+	// StationID is the reference station ID for the types carrying one,
+	// see rtcm.StationID, and -1 otherwise
+	StationID int
+	// Received is when the chunk completing the frame was read
+	Received time.Time
+}
+
+// Messages returns a channel of the CRC-validated RTCM messages of the
+// stream as they arrive, for routing by type without framing the raw
+// bytes. Call it before Run or Connect. The stream is not read further
+// while the channel is full, so a slow consumer slows the client instead
+// of losing messages. The channel is closed when Run or Connect returns.
+func (c *Client) Messages() <-chan ReceivedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages == nil {
+		c.messages = make(chan ReceivedMessage, messageQueueSize)
+	}
+	return c.messages
+}
+
+// messageQueueSize is how many messages Messages buffers
+const messageQueueSize = 64
+
+// deliver sends msgs to the Messages channel, if there is one, waiting
+// while it is full. It fails once ctx is done.
+func (c *Client) deliver(ctx context.Context, msgs []rtcm.Message, received time.Time) error {
+	c.mu.Lock()
+	ch := c.messages
+	c.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		rm := ReceivedMessage{Message: msg, StationID: -1, Received: received}
+		if id, ok := rtcm.StationID(msg.Payload); ok {
+			rm.StationID = id
+		}
+		select {
+		case ch <- rm:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// closeMessages closes the Messages channel once the client has stopped
+func (c *Client) closeMessages() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages != nil {
+		close(c.messages)
+		c.messages = nil
+	}
+}
+
+// inspect decodes the RTCM frames in a chunk of the stream, counting them
+// by message type and logging each one at debug level, and returns them.
+// Station position messages are logged with the reference station ID and
+// coordinates. With CheckContinuity, gaps between observation epochs are
+// warned about.
+func (c *Client) inspect(framer *rtcm.Framer, data []byte) []rtcm.Message {
+	msgs := framer.Feed(data)
+
+	c.mu.Lock()
+	c.received += int64(len(data))
+	c.rate.add(len(data), time.Now())
+	if c.counts == nil {
+		c.counts = make(map[int]int)
+	}
+	for _, msg := range msgs {
+		c.counts[msg.Number]++
+	}
+	var gaps []rtcm.Gap
+	if c.CheckContinuity {
+		if c.continuity == nil {
+			c.continuity = rtcm.NewContinuity()
+		}
+		for _, msg := range msgs {
+			if gap, ok := c.continuity.Check(msg); ok {
+				gaps = append(gaps, gap)
+			}
+		}
+		c.noteGaps(gaps, time.Now())
+	}
+	c.mu.Unlock()
+	for _, gap := range gaps {
+		slog.Warn("Gap in RTCM epochs", "type", gap.Message, "gap", gap.Duration, "expected", gap.Expected)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	for _, msg := range msgs {
+		if msg.Number != 1005 && msg.Number != 1006 {
+			slog.Debug("RTCM message", "type", msg.Number, "bytes", len(msg.Frame))
+			continue
+		}
+		arp, err := rtcm.ParseStationARP(msg.Payload)
+		if err != nil {
+			slog.Warn("Invalid station message", "type", msg.Number, "err", err)
+			continue
+		}
+		slog.Debug("RTCM message", "type", msg.Number, "bytes", len(msg.Frame),
+			"station", arp.StationID, "x", arp.X, "y", arp.Y, "z", arp.Z, "height", arp.Height)
+	}
+	return msgs
+}
+
+// MessageCounts returns how many frames of each RTCM message type have
+// been received since the client was created
+func (c *Client) MessageCounts() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.counts)
+}
+
+// Gaps returns the epoch gaps found so far when CheckContinuity is set
+func (c *Client) Gaps() rtcm.GapStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.continuity == nil {
+		return rtcm.GapStats{}
+	}
+	return c.continuity.GapStats
+}
+
+// Bitrate returns the rate of the stream in bits per second, averaged
+// over about the last ten seconds
+func (c *Client) Bitrate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate.bitrate(time.Now())
+}
+
+// BytesReceived returns how many bytes of the stream have been received
+// since the client was created
+func (c *Client) BytesReceived() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.received
+}
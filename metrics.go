@@ -0,0 +1,93 @@
+package ntrip
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// handleMetrics serves the counters of Stats in the Prometheus text
+// exposition format, so the caster can be scraped without a client
+// library
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := s.Stats()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	metric(w, "ntrip_uptime_seconds", "gauge", "Seconds since the server started")
+	sample(w, "ntrip_uptime_seconds", nil, stats.Uptime)
+	metric(w, "ntrip_connections_accepted_total", "counter", "Connections let in by the client limits")
+	sample(w, "ntrip_connections_accepted_total", nil, float64(stats.Accepted))
+	metric(w, "ntrip_connections_rejected_total", "counter", "Connections turned away by the client limits")
+	sample(w, "ntrip_connections_rejected_total", nil, float64(stats.Rejected))
+
+	metric(w, "ntrip_clients", "gauge", "Connected clients per mountpoint")
+	for _, m := range stats.Mountpoints {
+		sample(w, "ntrip_clients", []string{"mountpoint", m.Name}, float64(m.ClientCount))
+	}
+	metric(w, "ntrip_mountpoint_bytes_received_total", "counter", "Source bytes broadcast to the mountpoint")
+	for _, m := range stats.Mountpoints {
+		sample(w, "ntrip_mountpoint_bytes_received_total", []string{"mountpoint", m.Name}, float64(m.BytesIn))
+	}
+	metric(w, "ntrip_mountpoint_bytes_forwarded_total", "counter", "Bytes written to the clients of the mountpoint")
+	for _, m := range stats.Mountpoints {
+		sample(w, "ntrip_mountpoint_bytes_forwarded_total", []string{"mountpoint", m.Name}, float64(m.BytesSent))
+	}
+
+	metric(w, "ntrip_mountpoint_bitrate", "gauge", "Source data rate of the mountpoint in bits per second over about ten seconds")
+	for _, m := range stats.Mountpoints {
+		sample(w, "ntrip_mountpoint_bitrate", []string{"mountpoint", m.Name}, float64(m.Bitrate))
+	}
+
+	metric(w, "ntrip_source_healthy", "gauge", "1 unless the source is silent past its data timeout")
+	for _, src := range stats.Sources {
+		healthy := 0.0
+		if src.Healthy {
+			healthy = 1
+		}
+		sample(w, "ntrip_source_healthy", []string{"source", src.Name}, healthy)
+	}
+	metric(w, "ntrip_source_bytes_read_total", "counter", "Bytes read from the source")
+	for _, src := range stats.Sources {
+		sample(w, "ntrip_source_bytes_read_total", []string{"source", src.Name}, float64(src.BytesRead))
+	}
+	metric(w, "ntrip_source_reconnects_total", "counter", "Times the source was reopened")
+	for _, src := range stats.Sources {
+		sample(w, "ntrip_source_reconnects_total", []string{"source", src.Name}, float64(src.Reconnects))
+	}
+	metric(w, "ntrip_source_buffer_dropped_bytes_total", "counter", "Bytes dropped because the source buffer was full")
+	for _, src := range stats.Sources {
+		sample(w, "ntrip_source_buffer_dropped_bytes_total", []string{"source", src.Name}, float64(src.BufferDropped))
+	}
+	metric(w, "ntrip_rtcm_messages_total", "counter", "RTCM frames read from the source by message type")
+	for _, src := range stats.Sources {
+		for _, n := range slices.Sorted(maps.Keys(src.Messages)) {
+			sample(w, "ntrip_rtcm_messages_total", []string{"source", src.Name, "type", strconv.Itoa(n)}, float64(src.Messages[n]))
+		}
+	}
+}
+
+// metric writes the HELP and TYPE lines introducing a metric
+func metric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value of a metric with its label name and value pairs
+func sample(w io.Writer, name string, labels []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + "=" + strconv.Quote(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
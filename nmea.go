@@ -0,0 +1,155 @@
+package ntrip
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNMEALen bounds a sentence collected by nmeaSplitter. The standard
+// allows 82 characters, some receivers' proprietary sentences run longer.
+const maxNMEALen = 256
+
+// nmeaSplitter collects the NMEA sentences among the bytes the RTCM framer
+// skips on a line that carries both
+type nmeaSplitter struct {
+	line []byte
+	// inLine is set between a '$' and the end of its line
+	inLine bool
+}
+
+// feed scans data for sentences and returns the complete ones with a valid
+// checksum, without the line ending
+func (n *nmeaSplitter) feed(data []byte) []string {
+	var sentences []string
+	for _, b := range data {
+		switch {
+		case b == '$':
+			n.line, n.inLine = append(n.line[:0], b), true
+		case !n.inLine:
+		case b == '\r' || b == '\n':
+			if s := string(n.line); validNMEA(s) {
+				sentences = append(sentences, s)
+			}
+			n.inLine = false
+		case b < 0x20 || b > 0x7E || len(n.line) >= maxNMEALen:
+			// Binary data, not a sentence after all
+			n.inLine = false
+		default:
+			n.line = append(n.line, b)
+		}
+	}
+	return sentences
+}
+
+// validNMEA reports whether s is a "$...*hh" sentence with a matching
+// checksum
+func validNMEA(s string) bool {
+	body, sum, ok := strings.Cut(strings.TrimPrefix(s, "$"), "*")
+	return ok && len(body) >= 5 && strings.EqualFold(sum, fmt.Sprintf("%02X", nmeaChecksum(body)))
+}
+
+// openNMEALog opens the file a source's NMEA sentences are appended to,
+// or returns nil when it has none or it cannot be opened
+func (s *Server) openNMEALog(src *source) io.WriteCloser {
+	if src.config.NMEALog == "" {
+		return nil
+	}
+	f, err := os.OpenFile(src.config.NMEALog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		slog.Error("Failed to open NMEA log, logging sentences instead", "source", src.name, "err", err)
+		return nil
+	}
+	return f
+}
+
+// handleNMEA writes out the sentences collected while framing the last
+// chunk of a source and records its GGA position
+func (s *Server) handleNMEA(src *source, w io.Writer) {
+	for _, sentence := range src.sentences {
+		if w != nil {
+			if _, err := io.WriteString(w, sentence+"\r\n"); err != nil {
+				slog.Warn("Error writing NMEA log", "source", src.name, "err", err)
+			}
+		} else {
+			slog.Debug("NMEA sentence", "source", src.name, "sentence", sentence)
+		}
+		if len(sentence) < 6 || sentence[3:6] != "GGA" {
+			continue
+		}
+		pos, err := parseGGA(sentence)
+		if err != nil {
+			continue
+		}
+		pos.Received = time.Now()
+		s.mu.Lock()
+		src.gga = &pos
+		s.mu.Unlock()
+	}
+	src.sentences = src.sentences[:0]
+}
+
+// GGAPosition is the receiver position from a GGA sentence
+type GGAPosition struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Altitude   float64 `json:"altitude"` // Above mean sea level, in meters
+	Quality    int     `json:"fix_quality"`
+	Satellites int     `json:"satellites"`
+	HDOP       float64 `json:"hdop"`
+	// UTC is the hhmmss.ss time of the fix as sent
+	UTC      string    `json:"utc"`
+	Received time.Time `json:"received"`
+}
+
+// parseGGA decodes a checksummed GGA sentence. Sentences without a fix
+// carry no position and are rejected.
+func parseGGA(sentence string) (GGAPosition, error) {
+	body, _, _ := strings.Cut(strings.TrimPrefix(sentence, "$"), "*")
+	f := strings.Split(body, ",")
+	if len(f) < 10 || len(f[0]) < 5 || f[0][2:5] != "GGA" {
+		return GGAPosition{}, fmt.Errorf("not a GGA sentence: %s", sentence)
+	}
+	var pos GGAPosition
+	var err error
+	pos.Quality, _ = strconv.Atoi(f[6])
+	if pos.Quality == 0 || f[2] == "" || f[4] == "" {
+		return GGAPosition{}, fmt.Errorf("GGA sentence has no fix: %s", sentence)
+	}
+	if pos.Latitude, err = nmeaDegrees(f[2], f[3], 2); err != nil {
+		return GGAPosition{}, err
+	}
+	if pos.Longitude, err = nmeaDegrees(f[4], f[5], 3); err != nil {
+		return GGAPosition{}, err
+	}
+	pos.UTC = f[1]
+	pos.Satellites, _ = strconv.Atoi(f[7])
+	pos.HDOP, _ = strconv.ParseFloat(f[8], 64)
+	pos.Altitude, _ = strconv.ParseFloat(f[9], 64)
+	return pos, nil
+}
+
+// nmeaDegrees converts a (d)ddmm.mmmm coordinate with degreeDigits digits
+// of degrees and its hemisphere to signed decimal degrees
+func nmeaDegrees(value, hemisphere string, degreeDigits int) (float64, error) {
+	if len(value) < degreeDigits {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	deg, err := strconv.ParseFloat(value[:degreeDigits], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	minutes, err := strconv.ParseFloat(value[degreeDigits:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", value)
+	}
+	deg += minutes / 60
+	if hemisphere == "S" || hemisphere == "W" {
+		deg = -deg
+	}
+	return deg, nil
+}
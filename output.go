@@ -0,0 +1,346 @@
+package ntrip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingFile writes the stream to the client's output file, moving on to
+// a new timestamped file once the size or age limit is reached. Chunks are
+// never split, so every byte lands in exactly one file. With a flush
+// interval writes are batched in memory and flushed on a timer.
+type rotatingFile struct {
+	c       *Client
+	mu      sync.Mutex // Serializes writes with the flush timer
+	f       *os.File
+	w       *bufio.Writer // Buffers writes to f, nil when unbuffered
+	written int64
+	opened  time.Time
+	gzips   sync.WaitGroup
+	stop    chan struct{} // Closed to stop the flush timer
+
+	free        int64     // Estimated free space on the output volume
+	freeChecked time.Time // When free was last read from the volume
+}
+
+// outputFile is a file written in the current run, for the disk guard
+// and naming
+type outputFile struct {
+	name   string
+	size   int64
+	pruned bool // Deleted by the disk guard
+}
+
+// outputBufferSize is the write buffer used with a flush interval
+const outputBufferSize = 64 * 1024
+
+// ErrDiskGuard is returned by Run when the output reaches the client's
+// MaxTotalBytes or MinFreeBytes limit and ExitOnDiskGuard is set
+var ErrDiskGuard = errors.New("disk guard reached")
+
+// openOutput opens the client's current output file for appending
+func (c *Client) openOutput() (*rotatingFile, error) {
+	f, err := appendFile(c.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{c: c, f: f, opened: time.Now()}
+	if info, err := f.Stat(); err == nil {
+		r.written = info.Size()
+	}
+	if n := len(c.outputs); n == 0 || c.outputs[n-1].name != c.OutputFile {
+		c.outputs = append(c.outputs, outputFile{name: c.OutputFile, size: r.written})
+	}
+	if c.FlushInterval > 0 {
+		r.w = bufio.NewWriterSize(f, outputBufferSize)
+		r.stop = make(chan struct{})
+		go r.flushLoop(c.FlushInterval)
+	}
+	return r, nil
+}
+
+// flushLoop writes buffered data to disk every interval until Close
+func (r *rotatingFile) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if err := r.w.Flush(); err != nil {
+				slog.Error("Failed to flush output", "file", r.f.Name(), "err", err)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// appendFile opens name for appending, creating it and its directory if
+// needed
+func appendFile(name string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open RTCM file: %v", err)
+	}
+	return f, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.c.guarded {
+		return len(p), nil
+	}
+	if err := r.guard(len(p)); err != nil {
+		slog.Error("Stopped writing output", "file", r.f.Name(), "reason", err)
+		r.c.guarded = true
+		if r.c.ExitOnDiskGuard {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	var n int
+	var err error
+	if r.w != nil {
+		n, err = r.w.Write(p)
+	} else {
+		n, err = r.f.Write(p)
+	}
+	r.written += int64(n)
+	r.c.outputs[len(r.c.outputs)-1].size += int64(n)
+	r.free -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	if r.full() {
+		if err := r.rotate(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// guard checks that n more bytes stay within the disk limits, pruning old
+// files of the run to make room when enabled. The caller holds mu.
+func (r *rotatingFile) guard(n int) error {
+	for {
+		var reason string
+		if max := r.c.MaxTotalBytes; max > 0 && r.total()+int64(n) > max {
+			reason = fmt.Sprintf("output would exceed %d bytes", max)
+		} else if min := r.c.MinFreeBytes; min > 0 && r.freeSpace()-int64(n) < min {
+			reason = fmt.Sprintf("less than %d bytes would be left free", min)
+		}
+		if reason == "" {
+			return nil
+		}
+		if !r.c.PruneOutput || !r.prune() {
+			return fmt.Errorf("%w: %s", ErrDiskGuard, reason)
+		}
+	}
+}
+
+// total returns the bytes in the files of this run
+func (r *rotatingFile) total() int64 {
+	var total int64
+	for _, o := range r.c.outputs {
+		if !o.pruned {
+			total += o.size
+		}
+	}
+	return total
+}
+
+// freeSpace returns the free space on the output volume, reading it at
+// most once a second and counting down the bytes written in between.
+// An unknown free space is reported as unlimited.
+func (r *rotatingFile) freeSpace() int64 {
+	if time.Since(r.freeChecked) >= time.Second {
+		free, ok := diskFree(filepath.Dir(r.f.Name()))
+		if !ok {
+			free = math.MaxInt64
+		}
+		r.free, r.freeChecked = free, time.Now()
+	}
+	return r.free
+}
+
+// prune deletes the oldest rotated-out file of the run, reporting whether
+// there was one to delete
+func (r *rotatingFile) prune() bool {
+	current := len(r.c.outputs) - 1
+	i := 0
+	for i < current && r.c.outputs[i].pruned {
+		i++
+	}
+	if i == current {
+		return false
+	}
+	// The file may still be being compressed
+	r.gzips.Wait()
+	r.c.outputs[i].pruned = true
+	name := r.c.outputs[i].name
+	if !exists(name) {
+		name += ".gz"
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Failed to prune old output", "file", name, "err", err)
+	} else {
+		slog.Info("Pruned old output to make room", "file", name)
+	}
+	r.freeChecked = time.Time{}
+	return true
+}
+
+// full reports whether the current file has reached a rotation limit
+func (r *rotatingFile) full() bool {
+	if r.c.RotateSize > 0 && r.written >= r.c.RotateSize {
+		return true
+	}
+	return r.c.RotateInterval > 0 && time.Since(r.opened) >= r.c.RotateInterval
+}
+
+// rotate closes the current file and opens the next one. The caller holds
+// mu.
+func (r *rotatingFile) rotate() error {
+	old := r.f.Name()
+	if r.w != nil {
+		if err := r.w.Flush(); err != nil {
+			return fmt.Errorf("failed to flush %s: %v", old, err)
+		}
+	}
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", old, err)
+	}
+	if r.c.Compress {
+		r.gzips.Add(1)
+		go func() {
+			defer r.gzips.Done()
+			if err := gzipFile(old); err != nil {
+				slog.Error("Failed to compress rotated file", "err", err)
+			}
+		}()
+	}
+
+	r.c.OutputFile = nextName(r.c.TimestampedName(), r.c.outputs)
+	f, err := appendFile(r.c.OutputFile)
+	if err != nil {
+		return err
+	}
+	slog.Info("Rotated output", "file", r.c.OutputFile)
+	r.f, r.written, r.opened = f, 0, time.Now()
+	r.c.outputs = append(r.c.outputs, outputFile{name: r.c.OutputFile})
+	if r.w != nil {
+		r.w.Reset(f)
+	}
+	return nil
+}
+
+// Close flushes and closes the current file and waits for pending
+// compression
+func (r *rotatingFile) Close() error {
+	if r.stop != nil {
+		close(r.stop)
+	}
+	r.mu.Lock()
+	var err error
+	if r.w != nil {
+		err = r.w.Flush()
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.mu.Unlock()
+	r.gzips.Wait()
+	return err
+}
+
+// nextName returns name, or name with a sequence suffix when several
+// files are started within the same second. Names already used in this
+// run are skipped even once pruned, so the files keep sorting in order.
+func nextName(name string, used []outputFile) string {
+	taken := func(candidate string) bool {
+		for _, o := range used {
+			if o.name == candidate {
+				return true
+			}
+		}
+		return exists(candidate) || exists(candidate+".gz")
+	}
+	candidate := name
+	for i := 1; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s_%03d", name, i)
+	}
+	return candidate
+}
+
+// namePlaceholder matches the placeholders of NameTemplate
+var namePlaceholder = regexp.MustCompile(`\{(mount|host|output)\}`)
+
+// expandName fills in the placeholders of template and formats the text
+// around them as a time layout, so that a mountpoint like "RTCM3" is not
+// read as a layout element
+func (c *Client) expandName(template string, t time.Time) string {
+	values := map[string]string{"mount": c.Mountpoint, "host": c.host(), "output": c.base()}
+	var b strings.Builder
+	last := 0
+	for _, m := range namePlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		b.WriteString(t.Format(template[last:m[0]]))
+		// A placeholder never adds directories of its own
+		b.WriteString(strings.NewReplacer("/", "_", "\\", "_").Replace(values[template[m[2]:m[3]]]))
+		last = m[1]
+	}
+	b.WriteString(t.Format(template[last:]))
+	return b.String()
+}
+
+// exists reports whether a file is present at name
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// gzipFile compresses name to name.gz and removes the original
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", name, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(name + ".gz")
+	if err != nil {
+		return fmt.Errorf("failed to compress %s: %v", name, err)
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to compress %s: %v", name, err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to compress %s: %v", name, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %v", name, err)
+	}
+	return os.Remove(name)
+}
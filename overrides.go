@@ -0,0 +1,116 @@
+package ntrip
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// setting is a config field that can be overridden from the environment,
+// as NTRIP_<KEY>, or from a command-line flag named after its key
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, v string) error
+	// noFlag leaves the setting to an existing dedicated flag
+	noFlag bool
+}
+
+var overridable = []setting{
+	{key: "server.port", usage: "caster port", set: intField(func(c *Config) *int { return &c.Server.Port })},
+	{key: "server.host", usage: "caster bind address", set: stringField(func(c *Config) *string { return &c.Server.Host })},
+	{key: "server.timeout", usage: "idle client timeout in seconds", set: intField(func(c *Config) *int { return &c.Server.Timeout })},
+	{key: "server.max_clients", usage: "maximum concurrent connections", set: intField(func(c *Config) *int { return &c.Server.MaxClients })},
+	{key: "server.max_clients_per_ip", usage: "maximum concurrent connections per address", set: intField(func(c *Config) *int { return &c.Server.MaxClientsPerIP })},
+	{key: "server.keepalive_interval", usage: "keepalive interval in seconds", set: intField(func(c *Config) *int { return &c.Server.KeepaliveInterval })},
+	{key: "server.tcp_keepalive", usage: "TCP keepalive period in seconds, -1 disables", set: intField(func(c *Config) *int { return &c.Server.TCPKeepalive })},
+	{key: "server.write_timeout", usage: "seconds a write to a client may block, -1 disables", set: intField(func(c *Config) *int { return &c.Server.WriteTimeout })},
+	{key: "server.drain_timeout", usage: "seconds a drain waits for clients to reach a frame boundary", set: intField(func(c *Config) *int { return &c.Server.DrainTimeout })},
+	{key: "server.read_buffer_size", usage: "bytes read from a client connection at once", set: intField(func(c *Config) *int { return &c.Server.ReadBufferSize })},
+	{key: "server.banner", usage: "caster name in the Server header", set: stringField(func(c *Config) *string { return &c.Server.Banner })},
+	{key: "server.tls.cert_file", usage: "TLS certificate file", set: stringField(func(c *Config) *string { return &c.Server.TLS.CertFile })},
+	{key: "server.tls.key_file", usage: "TLS key file", set: stringField(func(c *Config) *string { return &c.Server.TLS.KeyFile })},
+	{key: "server.tls.port", usage: "separate TLS port", set: intField(func(c *Config) *int { return &c.Server.TLS.Port })},
+	{key: "serial.type", usage: "default source type: serial, tcp, ntrip or file", set: stringField(func(c *Config) *string { return &c.Serial.Type })},
+	{key: "serial.port", usage: "serial device of the default source", set: stringField(func(c *Config) *string { return &c.Serial.Port })},
+	{key: "serial.baud_rate", usage: "baud rate of the default source", set: intField(func(c *Config) *int { return &c.Serial.BaudRate })},
+	{key: "serial.address", usage: "host:port of a tcp default source", set: stringField(func(c *Config) *string { return &c.Serial.Address })},
+	{key: "serial.read_buffer_size", usage: "bytes read from the default source at once", set: intField(func(c *Config) *int { return &c.Serial.ReadBufferSize })},
+	{key: "serial.path", usage: "RTCM capture replayed by a file default source", set: stringField(func(c *Config) *string { return &c.Serial.Path })},
+	{key: "admin.addr", usage: "admin HTTP listen address", set: stringField(func(c *Config) *string { return &c.Admin.Addr })},
+	{key: "admin.token", usage: "bearer token required to disconnect clients", set: stringField(func(c *Config) *string { return &c.Admin.Token })},
+	{key: "metrics.addr", usage: "Prometheus /metrics listen address", set: stringField(func(c *Config) *string { return &c.Metrics.Addr })},
+	{key: "logging.level", set: stringField(func(c *Config) *string { return &c.Logging.Level }), noFlag: true},
+	{key: "logging.format", set: stringField(func(c *Config) *string { return &c.Logging.Format }), noFlag: true},
+}
+
+func stringField(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func intField(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("not a number: %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// envName returns the environment variable overriding a setting
+func envName(key string) string {
+	return "NTRIP_" + strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+// flagName returns the command-line flag overriding a setting
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+// applyEnv overrides config fields from NTRIP_* environment variables
+func (c *Config) applyEnv() error {
+	for _, st := range overridable {
+		v, ok := os.LookupEnv(envName(st.key))
+		if !ok {
+			continue
+		}
+		if err := st.set(c, v); err != nil {
+			return fmt.Errorf("%s: %v", envName(st.key), err)
+		}
+	}
+	return nil
+}
+
+// ConfigFlags registers a flag for each overridable setting, such as
+// -server-port or -serial-port, and returns an override for LoadConfig
+// that applies the flags given on the command line
+func ConfigFlags(fs *flag.FlagSet) func(*Config) error {
+	values := make(map[string]*string)
+	for _, st := range overridable {
+		if st.noFlag {
+			continue
+		}
+		values[st.key] = fs.String(flagName(st.key), "", fmt.Sprintf("Override %s, the %s (env %s)", st.key, st.usage, envName(st.key)))
+	}
+	return func(c *Config) error {
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			for _, st := range overridable {
+				if st.noFlag || flagName(st.key) != f.Name || err != nil {
+					continue
+				}
+				if e := st.set(c, *values[st.key]); e != nil {
+					err = fmt.Errorf("-%s: %v", f.Name, e)
+				}
+			}
+		})
+		return err
+	}
+}
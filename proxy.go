@@ -0,0 +1,272 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyFromEnvironment returns the proxy for connecting to the caster at
+// addr from HTTPS_PROXY for TLS casters or HTTP_PROXY otherwise, falling
+// back to ALL_PROXY, in upper or lower case. It is empty when none is set
+// or NO_PROXY lists the caster's host.
+func ProxyFromEnvironment(addr string, useTLS bool) string {
+	if noProxy(hostOnly(addr)) {
+		return ""
+	}
+	names := []string{"HTTP_PROXY", "ALL_PROXY"}
+	if useTLS {
+		names[0] = "HTTPS_PROXY"
+	}
+	for _, name := range names {
+		if v := getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// getenv returns the environment variable name, or its lower case form
+func getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// noProxy reports whether NO_PROXY exempts host: "*" matches every host,
+// other entries match the host itself or, as a domain, its subdomains
+func noProxy(host string) bool {
+	for _, entry := range strings.Split(getenv("NO_PROXY"), ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || strings.EqualFold(host, entry) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialProxy opens a tunnel to addr through the http:// (CONNECT) or
+// socks5:// proxy at proxyURL, which may carry user:password credentials.
+// The NTRIP request, and the TLS handshake of a TLS caster, go through the
+// tunnel.
+func dialProxy(ctx context.Context, d *net.Dialer, proxyURL, addr string) (net.Conn, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, want http://host:port or socks5://host:port", proxyURL)
+	}
+	var tunnel func(net.Conn, *url.URL, string) (net.Conn, error)
+	defaultPort := "1080"
+	switch u.Scheme {
+	case "http":
+		tunnel, defaultPort = httpConnect, "8080"
+	case "socks5", "socks5h":
+		tunnel = socks5Connect
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, want http or socks5", u.Scheme)
+	}
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %v", proxyAddr, err)
+	}
+	// The dial timeout also bounds setting up the tunnel
+	if d.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.Timeout))
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	tunneled, err := tunnel(conn, u, addr)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %v", proxyAddr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tunneled, nil
+}
+
+// httpConnect asks an HTTP proxy to CONNECT to addr
+func httpConnect(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req += "Proxy-Authorization: Basic " + auth + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONNECT response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s refused: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// SOCKS5 protocol values, RFC 1928 and RFC 1929
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksPasswordAuth = 2
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+)
+
+// socks5Connect asks a SOCKS5 proxy to connect to addr, resolving its
+// host name on the proxy
+func socks5Connect(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port in %s", addr)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host name too long: %s", host)
+	}
+
+	methods := []byte{socksVersion, 1, socksNoAuth}
+	if u.User != nil {
+		methods = []byte{socksVersion, 2, socksNoAuth, socksPasswordAuth}
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return nil, err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 greeting: %v", err)
+	}
+	if reply[0] != socksVersion {
+		return nil, fmt.Errorf("not a SOCKS5 proxy")
+	}
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPasswordAuth:
+		if u.User == nil {
+			return nil, fmt.Errorf("SOCKS5 proxy requires a username and password")
+		}
+		if err := socks5Auth(conn, u.User); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("SOCKS5 proxy accepts none of the offered authentication methods")
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		req = append(append(req, socksIPv4), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, socksIPv6), ip.To16()...)
+	} else {
+		req = append(append(req, socksDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	// The reply echoes the bound address, which is read and ignored
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 reply: %v", err)
+	}
+	if header[1] != 0 {
+		return nil, fmt.Errorf("SOCKS5 connect to %s failed: %s", addr, socksReplyText(header[1]))
+	}
+	var skip int
+	switch header[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, fmt.Errorf("invalid SOCKS5 reply: %v", err)
+		}
+		skip = int(n[0])
+	default:
+		return nil, fmt.Errorf("invalid SOCKS5 reply address type %d", header[3])
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return nil, fmt.Errorf("invalid SOCKS5 reply: %v", err)
+	}
+	return conn, nil
+}
+
+// socks5Auth authenticates with a username and password
+func socks5Auth(conn net.Conn, user *url.Userinfo) error {
+	password, _ := user.Password()
+	name := user.Username()
+	if len(name) > 255 || len(password) > 255 {
+		return errors.New("SOCKS5 username or password too long")
+	}
+	req := append([]byte{1, byte(len(name))}, name...)
+	req = append(append(req, byte(len(password))), password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("invalid SOCKS5 authentication reply: %v", err)
+	}
+	if reply[1] != 0 {
+		return errors.New("SOCKS5 proxy rejected the username or password")
+	}
+	return nil
+}
+
+// socksReplyText describes a SOCKS5 reply code
+func socksReplyText(code byte) string {
+	switch code {
+	case 1:
+		return "general failure"
+	case 2:
+		return "not allowed by ruleset"
+	case 3:
+		return "network unreachable"
+	case 4:
+		return "host unreachable"
+	case 5:
+		return "connection refused"
+	case 6:
+		return "TTL expired"
+	case 7:
+		return "command not supported"
+	case 8:
+		return "address type not supported"
+	}
+	return fmt.Sprintf("error %d", code)
+}
@@ -0,0 +1,53 @@
+package ntrip
+
+import (
+	"math"
+	"time"
+)
+
+// rateWindow is the time constant of the bitrate average
+const rateWindow = 10 * time.Second
+
+// rateMeter estimates the rate of a byte stream in bits per second as an
+// exponential moving average over about rateWindow. Bytes are gathered
+// into samples of at least a second, so bursty streams read steadily.
+type rateMeter struct {
+	rate    float64   // Bits per second as of start
+	start   time.Time // Start of the sample being gathered
+	pending int64     // Bytes in the current sample
+	primed  bool      // Whether rate holds a first complete sample
+}
+
+// add counts n bytes arriving at now
+func (r *rateMeter) add(n int, now time.Time) {
+	if r.start.IsZero() {
+		r.start = now
+	}
+	if now.Sub(r.start) >= time.Second {
+		r.rate, r.primed = r.at(now), true
+		r.start, r.pending = now, 0
+	}
+	r.pending += int64(n)
+}
+
+// bitrate returns the average rate at now, decaying while no data arrives
+func (r *rateMeter) bitrate(now time.Time) int {
+	if r.start.IsZero() {
+		return 0
+	}
+	return int(math.Round(r.at(now)))
+}
+
+// at folds the pending sample into the average as if it ended at now
+func (r *rateMeter) at(now time.Time) float64 {
+	elapsed := now.Sub(r.start)
+	if elapsed < time.Second {
+		return r.rate
+	}
+	sample := float64(r.pending*8) / elapsed.Seconds()
+	if !r.primed {
+		return sample
+	}
+	alpha := 1 - math.Exp(-elapsed.Seconds()/rateWindow.Seconds())
+	return r.rate + alpha*(sample-r.rate)
+}
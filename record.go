@@ -0,0 +1,86 @@
+package ntrip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timestamped output files are a sequence of records, one per chunk read
+// from the caster, each made of
+//
+//	8 bytes  arrival time, Unix nanoseconds, big-endian signed
+//	4 bytes  payload length, big-endian unsigned
+//	n bytes  payload, the stream bytes exactly as received
+//
+// There is no file header, so a file can be appended to and rotated files
+// concatenated. Joining the payloads gives back the raw stream.
+const recordHeaderLen = 12
+
+// maxRecordLen bounds the payload length accepted by RecordReader, far
+// above any read chunk, so a corrupt header fails instead of allocating
+const maxRecordLen = 16 << 20
+
+// Record is a chunk of the stream with the time it arrived
+type Record struct {
+	Time time.Time
+	Data []byte
+}
+
+// recordWriter frames each Write as a timestamped record, writing it to w
+// in one call so rotation never splits a record
+type recordWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (r *recordWriter) Write(p []byte) (int, error) {
+	r.buf = appendRecord(r.buf[:0], time.Now(), p)
+	if _, err := r.w.Write(r.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendRecord appends the record of data arriving at t to buf
+func appendRecord(buf []byte, t time.Time, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, uint64(t.UnixNano()))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+// RecordReader reads the records of a timestamped output file
+type RecordReader struct {
+	r *bufio.Reader
+}
+
+// NewRecordReader reads records from r, such as an output file written
+// with Timestamped or its gzipped rotation
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, or io.EOF after the last one. A record cut
+// short, as by a crash mid-write, returns io.ErrUnexpectedEOF.
+func (rr *RecordReader) Next() (Record, error) {
+	var header [recordHeaderLen]byte
+	if _, err := io.ReadFull(rr.r, header[:]); err != nil {
+		return Record{}, err
+	}
+	length := binary.BigEndian.Uint32(header[8:])
+	if length > maxRecordLen {
+		return Record{}, fmt.Errorf("record of %d bytes is too long, the file is probably not timestamped", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rr.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	nanos := int64(binary.BigEndian.Uint64(header[:8]))
+	return Record{Time: time.Unix(0, nanos), Data: data}, nil
+}
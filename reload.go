@@ -0,0 +1,107 @@
+package ntrip
+
+import (
+	"log/slog"
+	"net"
+)
+
+// Reload applies a new configuration to the running server without
+// dropping the listener, the sources or unaffected clients.
+//
+// Hot-reloadable: server.timeout, client_buffer_size, slow_client_policy,
+// keepalive_interval, tcp_keepalive, write_timeout, drain_timeout,
+// read_buffer_size, max_clients, max_clients_per_ip, responses, banner,
+// chunked, users, the legacy authentication block, sourcetable and
+// mountpoints. Clients of removed or disabled mountpoints are
+// disconnected. Buffer size, keepalive, write timeout and chunked changes
+// apply to clients that connect afterwards.
+//
+// Restart required: server.port, host and tls, admin.addr and token,
+// metrics.addr, logging, and the serial and sources settings. Changes to
+// the admin and metrics settings are logged as ignored.
+func (s *Server) Reload(config Config) {
+	config = withDefaults(config)
+
+	s.mu.Lock()
+	if config.Admin != s.config.Admin {
+		slog.Warn("Admin settings changed, restart to apply them")
+	}
+	if config.Metrics != s.config.Metrics {
+		slog.Warn("Metrics settings changed, restart to apply them")
+	}
+	config.Server.Port = s.config.Server.Port
+	config.Server.Host = s.config.Server.Host
+	config.Server.TLS = s.config.Server.TLS
+	config.Admin = s.config.Admin
+	config.Metrics = s.config.Metrics
+	config.Logging = s.config.Logging
+	config.Serial = s.config.Serial
+	config.Sources = s.config.Sources
+	s.config = config
+	removed := s.setMounts(config)
+	count := len(s.mounts)
+	s.mu.Unlock()
+
+	for _, c := range removed {
+		c.log.Info("Disconnecting client", "reason", "mountpoint removed", "mountpoint", c.mount.name)
+		s.removeClient(c)
+	}
+	slog.Info("Configuration reloaded", "mountpoints", count)
+}
+
+// setMounts builds the mountpoint table from the configuration and wires
+// each mountpoint to its source. Mountpoints that already exist keep their
+// clients, the clients of mountpoints that are gone are returned for the
+// caller to disconnect. The caller must hold s.mu, or be NewServer.
+func (s *Server) setMounts(config Config) []*clientConn {
+	mounts := config.Mountpoints
+	if len(mounts) == 0 {
+		mounts = []MountpointConfig{{Name: defaultMountpoint, Source: defaultSource}}
+	}
+
+	for _, src := range s.sources {
+		src.mounts = nil
+	}
+	active := make(map[string]*mountpoint)
+	for _, mc := range mounts {
+		if !mc.enabled() {
+			continue
+		}
+		m, ok := s.mounts[mc.Name]
+		if !ok {
+			m = &mountpoint{
+				name:    mc.Name,
+				clients: make(map[net.Conn]*clientConn),
+			}
+		}
+		m.users = mc.Users
+		m.configure(mc)
+		active[mc.Name] = m
+
+		name := mc.Source
+		if name == "" {
+			name = defaultSource
+		}
+		src, ok := s.sources[name]
+		if !ok {
+			slog.Warn("Mountpoint refers to unknown source", "mountpoint", mc.Name, "source", name)
+			continue
+		}
+		if s.ctx != nil && !src.running && len(src.mounts) == 0 {
+			slog.Warn("Source is not running, restart the server to open it", "mountpoint", mc.Name, "source", name)
+		}
+		src.mounts = append(src.mounts, m)
+	}
+
+	var removed []*clientConn
+	for name, m := range s.mounts {
+		if _, ok := active[name]; ok {
+			continue
+		}
+		for _, c := range m.clients {
+			removed = append(removed, c)
+		}
+	}
+	s.mounts = active
+	return removed
+}
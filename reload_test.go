@@ -0,0 +1,33 @@
+package ntrip
+
+import "testing"
+
+// TestReloadKeepsListeners reloads a configuration moving the admin and
+// metrics servers and checks the running settings are kept
+func TestReloadKeepsListeners(t *testing.T) {
+	var config Config
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	config.Admin.Addr = "127.0.0.1:8081"
+	config.Admin.Token = "s3cret"
+	config.Metrics.Addr = "127.0.0.1:9101"
+	s := NewServer(config)
+
+	changed := config
+	changed.Admin.Addr = "0.0.0.0:8081"
+	changed.Admin.Token = ""
+	changed.Metrics.Addr = "0.0.0.0:9101"
+	changed.Mountpoints = []MountpointConfig{{Name: "RTCM3"}, {Name: "OTHER"}}
+	s.Reload(changed)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.config.Admin != config.Admin {
+		t.Errorf("admin settings %+v after reload, want %+v", s.config.Admin, config.Admin)
+	}
+	if s.config.Metrics != config.Metrics {
+		t.Errorf("metrics settings %+v after reload, want %+v", s.config.Metrics, config.Metrics)
+	}
+	if _, ok := s.mounts["OTHER"]; !ok {
+		t.Error("mountpoint added by the reload is missing")
+	}
+}
@@ -0,0 +1,109 @@
+package ntrip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errMalformedRequest is returned for requests that are not valid NTRIP
+// requests and should be answered with 400 Bad Request
+var errMalformedRequest = errors.New("malformed request")
+
+// maxHeaderLines bounds the header block so a client cannot make the
+// server buffer an endless request
+const maxHeaderLines = 100
+
+// maxRequestLine bounds the length of the request line and of each
+// header line, so a line that never ends cannot grow the buffer either
+const maxRequestLine = 4096
+
+// request is a parsed NTRIP client request
+type request struct {
+	method  string
+	path    string
+	proto   string
+	headers map[string]string
+}
+
+// mountpoint returns the requested mountpoint name, empty for the root.
+// Receivers differ in how they ask: "/RTCM3", "RTCM3" without the slash
+// and "/RTCM3?arg=1" all name RTCM3.
+func (r *request) mountpoint() string {
+	name, _, _ := strings.Cut(r.path, "?")
+	return strings.TrimSpace(strings.TrimPrefix(name, "/"))
+}
+
+// version reports the NTRIP version requested via the Ntrip-Version header
+func (r *request) version() int {
+	if strings.HasPrefix(strings.ToLower(r.headers["ntrip-version"]), "ntrip/2") {
+		return NtripV2
+	}
+	return NtripV1
+}
+
+func (r *request) userAgent() string {
+	return r.headers["user-agent"]
+}
+
+// readRequest reads the request line and header block up to the blank
+// line ending it. Header names are lower-cased.
+func readRequest(reader *bufio.Reader) (*request, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: invalid request line %q", errMalformedRequest, strings.TrimSpace(line))
+	}
+	req := &request{
+		method:  fields[0],
+		path:    fields[1],
+		proto:   fields[2],
+		headers: make(map[string]string),
+	}
+	if req.method != "GET" {
+		return nil, fmt.Errorf("%w: unsupported method %s", errMalformedRequest, req.method)
+	}
+	if !strings.HasPrefix(req.proto, "HTTP/1.") {
+		return nil, fmt.Errorf("%w: unsupported protocol %s", errMalformedRequest, req.proto)
+	}
+
+	for i := 0; ; i++ {
+		if i == maxHeaderLines {
+			return nil, fmt.Errorf("%w: too many headers", errMalformedRequest)
+		}
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return req, nil
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid header line %q", errMalformedRequest, line)
+		}
+		req.headers[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+}
+
+// readLine reads a line including its newline, failing with
+// errMalformedRequest once it runs past maxRequestLine. Lines longer than
+// the reader's buffer are read in pieces.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		piece, err := reader.ReadSlice('\n')
+		if len(line)+len(piece) > maxRequestLine {
+			return "", fmt.Errorf("%w: line longer than %d bytes", errMalformedRequest, maxRequestLine)
+		}
+		line = append(line, piece...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ntrip
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		mountpoint string
+		version    int
+		agent      string
+		headers    map[string]string
+	}{
+		{
+			name:       "v1",
+			raw:        "GET /RTCM3 HTTP/1.0\r\nUser-Agent: NTRIP RTKLIB/2.4.3\r\nAuthorization: Basic dXNlcjpwYXNz\r\n\r\n",
+			mountpoint: "RTCM3",
+			version:    NtripV1,
+			agent:      "NTRIP RTKLIB/2.4.3",
+			headers:    map[string]string{"authorization": "Basic dXNlcjpwYXNz"},
+		},
+		{
+			name:       "v2",
+			raw:        "GET /RTCM3 HTTP/1.1\r\nHost: caster.example.com\r\nNtrip-Version: Ntrip/2.0\r\nUser-Agent: NTRIP ntrip-client/1.0\r\nConnection: close\r\n\r\n",
+			mountpoint: "RTCM3",
+			version:    NtripV2,
+			agent:      "NTRIP ntrip-client/1.0",
+			headers:    map[string]string{"host": "caster.example.com", "connection": "close"},
+		},
+		{
+			name:    "sourcetable",
+			raw:     "GET / HTTP/1.0\r\nUser-Agent: NTRIP test\r\n\r\n",
+			version: NtripV1,
+			agent:   "NTRIP test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.raw + "\xd3\x00\x00"))
+			req, err := readRequest(r)
+			if err != nil {
+				t.Fatalf("readRequest: %v", err)
+			}
+			if req.mountpoint() != tt.mountpoint || req.version() != tt.version || req.userAgent() != tt.agent {
+				t.Errorf("got mountpoint %q, version %d, agent %q, want %q, %d, %q",
+					req.mountpoint(), req.version(), req.userAgent(), tt.mountpoint, tt.version, tt.agent)
+			}
+			for name, value := range tt.headers {
+				if req.headers[name] != value {
+					t.Errorf("header %s = %q, want %q", name, req.headers[name], value)
+				}
+			}
+			if r.Buffered() != 3 {
+				t.Errorf("%d bytes left after the request, want the 3 that follow it", r.Buffered())
+			}
+		})
+	}
+}
+
+// TestMountpointVariants covers the ways receivers such as u-blox, Emlid
+// and Trimble name the mountpoint in the request line
+func TestMountpointVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"leading slash", "GET /RTCM3 HTTP/1.0", "RTCM3"},
+		{"no slash", "GET RTCM3 HTTP/1.0", "RTCM3"},
+		{"query string", "GET /RTCM3?arg=1 HTTP/1.0", "RTCM3"},
+		{"empty query string", "GET /RTCM3? HTTP/1.1", "RTCM3"},
+		{"sourcetable", "GET / HTTP/1.0", ""},
+		{"sourcetable query string", "GET /?strfilter=RTCM HTTP/1.0", ""},
+		{"single slash stripped", "GET //RTCM3 HTTP/1.0", "/RTCM3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := readRequest(bufio.NewReader(strings.NewReader(tt.line + "\r\n\r\n")))
+			if err != nil {
+				t.Fatalf("readRequest: %v", err)
+			}
+			if got := req.mountpoint(); got != tt.want {
+				t.Errorf("mountpoint = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMalformedRequest(t *testing.T) {
+	tests := map[string]string{
+		"method":        "POST /RTCM3 HTTP/1.1\r\n\r\n",
+		"protocol":      "GET /RTCM3 RTSP/1.0\r\n\r\n",
+		"request line":  "GET /RTCM3\r\n\r\n",
+		"header":        "GET /RTCM3 HTTP/1.0\r\nUser-Agent NTRIP\r\n\r\n",
+		"too many":      "GET /RTCM3 HTTP/1.0\r\n" + strings.Repeat("X-Padding: 1\r\n", maxHeaderLines) + "\r\n",
+		"not a request": "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03\r\n",
+		"long request":  "GET /" + strings.Repeat("A", maxRequestLine),
+		"long header":   "GET /RTCM3 HTTP/1.0\r\nUser-Agent: " + strings.Repeat("A", maxRequestLine) + "\r\n\r\n",
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readRequest(bufio.NewReader(strings.NewReader(raw)))
+			if !errors.Is(err, errMalformedRequest) {
+				t.Errorf("error = %v, want a malformed request", err)
+			}
+		})
+	}
+}
+
+// TestLongLineInSmallBuffer reads a header longer than the reader's
+// buffer but within maxRequestLine
+func TestLongLineInSmallBuffer(t *testing.T) {
+	agent := strings.Repeat("A", maxRequestLine/2)
+	raw := "GET /RTCM3 HTTP/1.0\r\nUser-Agent: " + agent + "\r\n\r\n"
+	req, err := readRequest(bufio.NewReaderSize(strings.NewReader(raw), 16))
+	if err != nil {
+		t.Fatalf("readRequest: %v", err)
+	}
+	if req.userAgent() != agent {
+		t.Errorf("User-Agent of %d bytes, want %d", len(req.userAgent()), len(agent))
+	}
+}
+
+func TestBadRequestResponse(t *testing.T) {
+	path, _ := testCapture(t)
+	_, addr := startServer(t, SerialConfig{Type: "file", Path: path, Loop: true, Rate: 1})
+	tests := map[string]string{
+		"method": "POST /RTCM3 HTTP/1.1\r\n\r\n",
+		// A line that never ends is cut off without waiting for more
+		"endless line": "GET /" + strings.Repeat("A", 2*maxRequestLine),
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			conn.Write([]byte(raw))
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil || !strings.Contains(line, "400") {
+				t.Errorf("response %q, %v, want 400 Bad Request", line, err)
+			}
+		})
+	}
+}
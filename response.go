@@ -0,0 +1,89 @@
+package ntrip
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// serverHeader is the Server header value of every response, the
+// configured banner and the build version
+func (s *Server) serverHeader() string {
+	return s.settings().Server.Banner + "/" + Version
+}
+
+// statusResponse builds a header-only response in the form expected by a
+// client speaking the given NTRIP version, with server as its Server
+// header. NTRIP v1 clients get plain HTTP/1.0, v2 clients get HTTP/1.1
+// with the Ntrip-Version header.
+func statusResponse(server string, version, status int, headers ...string) string {
+	var resp strings.Builder
+	if version == NtripV2 {
+		fmt.Fprintf(&resp, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+		resp.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+	} else {
+		fmt.Fprintf(&resp, "HTTP/1.0 %d %s\r\n", status, http.StatusText(status))
+	}
+	resp.WriteString("Server: " + server + "\r\n")
+	for _, h := range headers {
+		resp.WriteString(h + "\r\n")
+	}
+	resp.WriteString("Connection: close\r\n\r\n")
+	return resp.String()
+}
+
+// Status lines sent to NTRIP v1 clients before the stream
+const (
+	responseICY  = "icy"
+	responseHTTP = "http"
+)
+
+// defaultResponseRules lists agents known to expect an HTTP status line
+// even without Ntrip-Version. Everything else gets ICY.
+var defaultResponseRules = []ResponseRule{
+	{Agent: "curl", Response: responseHTTP},
+	{Agent: "wget", Response: responseHTTP},
+	{Agent: "mozilla", Response: responseHTTP},
+	{Agent: "python-requests", Response: responseHTTP},
+	{Agent: "go-http-client", Response: responseHTTP},
+}
+
+// responseStyle returns the status line style for a v1 client, checking
+// the configured rules before the built-in ones
+func responseStyle(rules []ResponseRule, agent string) string {
+	agent = strings.ToLower(agent)
+	for _, list := range [][]ResponseRule{rules, defaultResponseRules} {
+		for _, rule := range list {
+			if strings.Contains(agent, strings.ToLower(rule.Agent)) {
+				return rule.Response
+			}
+		}
+	}
+	return responseICY
+}
+
+// streamResponse is the header sent before the RTCM stream. NTRIP v1
+// clients get the legacy ICY status line unless style asks for HTTP. The
+// stream is open-ended, so there is never a Content-Length: the body runs
+// until the connection closes, or is sent in chunks when chunked is set
+// for a v2 client.
+func streamResponse(server string, version int, style string, chunked bool) string {
+	if version == NtripV2 {
+		headers := []string{"Content-Type: gnss/data", "Cache-Control: no-store"}
+		if chunked {
+			headers = append(headers, "Transfer-Encoding: chunked")
+		}
+		return statusResponse(server, NtripV2, http.StatusOK, headers...)
+	}
+	if style == responseHTTP {
+		return statusResponse(server, NtripV1, http.StatusOK, "Content-Type: gnss/data")
+	}
+	return "ICY 200 OK\r\n"
+}
+
+// chunk frames data as one chunk of a chunked transfer encoded body
+func chunk(data []byte) []byte {
+	framed := fmt.Appendf(nil, "%x\r\n", len(data))
+	framed = append(framed, data...)
+	return append(framed, "\r\n"...)
+}
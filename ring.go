@@ -0,0 +1,81 @@
+package ntrip
+
+import "sync"
+
+// ring is a bounded byte buffer between a source reader and the broadcast
+// fan-out. Writes never block: when the buffer is full the oldest bytes
+// are discarded so the reader keeps draining the device.
+type ring struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	buf       []byte
+	start     int // Index of the oldest buffered byte
+	n         int // Buffered bytes
+	highWater int
+	dropped   int64
+	closed    bool
+}
+
+func newRing(size int) *ring {
+	r := &ring{buf: make([]byte, size)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	written := len(p)
+	// Only the newest bytes fit
+	if len(p) > len(r.buf) {
+		r.dropped += int64(len(p) - len(r.buf))
+		p = p[len(p)-len(r.buf):]
+	}
+	if over := r.n + len(p) - len(r.buf); over > 0 {
+		r.dropped += int64(over)
+		r.start = (r.start + over) % len(r.buf)
+		r.n -= over
+	}
+	end := (r.start + r.n) % len(r.buf)
+	copied := copy(r.buf[end:], p)
+	copy(r.buf, p[copied:])
+	r.n += len(p)
+	r.highWater = max(r.highWater, r.n)
+
+	r.cond.Signal()
+	return written, nil
+}
+
+// Read blocks until data is buffered and copies out as much as fits in p.
+// It returns 0 once the ring is closed and drained.
+func (r *ring) Read(p []byte) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.n == 0 && !r.closed {
+		r.cond.Wait()
+	}
+
+	n := min(len(p), r.n)
+	first := copy(p[:n], r.buf[r.start:])
+	copy(p[first:n], r.buf)
+	r.start = (r.start + n) % len(r.buf)
+	r.n -= n
+	return n
+}
+
+// Close wakes the reader, which stops once the buffer is drained
+func (r *ring) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// stats returns the buffer size, the most bytes ever buffered and the
+// bytes discarded because the buffer was full
+func (r *ring) stats() (size, highWater int, dropped int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.buf), r.highWater, r.dropped
+}
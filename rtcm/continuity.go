@@ -0,0 +1,109 @@
+package rtcm
+
+import "time"
+
+// Epoch time wrap periods in milliseconds: GPS, Galileo, SBAS, QZSS and
+// BeiDou count from the start of the week, GLONASS from the start of the
+// day
+const (
+	weekMillis = 7 * 24 * 3600 * 1000
+	dayMillis  = 24 * 3600 * 1000
+)
+
+// EpochTime returns the observation epoch of an MSM or legacy 1004/1012
+// message in milliseconds, and the period after which the time wraps. ok
+// is false for other messages.
+func EpochTime(payload []byte) (ms, wrap uint32, ok bool) {
+	if len(payload) < 7 {
+		return 0, 0, false
+	}
+	number := MessageNumber(payload)
+	switch {
+	case number == 1004, number >= 1071 && number <= 1077,
+		number >= 1091 && number <= 1127:
+		return uint32(bits(payload, 24, 30)), weekMillis, true
+	case number == 1012:
+		return uint32(bits(payload, 24, 27)), dayMillis, true
+	case number >= 1081 && number <= 1087:
+		// The GLONASS MSM epoch starts with a 3 bit day of week
+		return uint32(bits(payload, 27, 27)), dayMillis, true
+	}
+	return 0, 0, false
+}
+
+// GapStats summarises the gaps found by a Continuity checker
+type GapStats struct {
+	Gaps    int           // Gaps detected
+	Missed  int           // Epochs estimated lost in those gaps
+	Longest time.Duration // Longest gap seen
+}
+
+// Gap is a jump in the epoch times of one message type
+type Gap struct {
+	Message  int
+	Duration time.Duration // Time between the epochs either side
+	Expected time.Duration // Usual interval of the message
+}
+
+// Continuity watches the epoch times of observation messages and reports
+// gaps longer than the interval each message type is normally sent at.
+// The interval is learned as the shortest step seen between epochs.
+type Continuity struct {
+	GapStats
+	streams map[int]*epochStream
+}
+
+type epochStream struct {
+	last     uint32
+	interval uint32 // 0 until a second epoch has been seen
+}
+
+// NewContinuity returns a checker with no history
+func NewContinuity() *Continuity {
+	return &Continuity{streams: make(map[int]*epochStream)}
+}
+
+// Check records the epoch of msg, returning the gap since the previous
+// epoch of the same type when it exceeds one and a half intervals.
+// Messages without an epoch time are ignored.
+func (c *Continuity) Check(msg Message) (Gap, bool) {
+	ms, wrap, ok := EpochTime(msg.Payload)
+	if !ok || ms >= wrap {
+		return Gap{}, false
+	}
+	st, seen := c.streams[msg.Number]
+	if !seen {
+		c.streams[msg.Number] = &epochStream{last: ms}
+		return Gap{}, false
+	}
+	step := (ms + wrap - st.last) % wrap
+	if step == 0 {
+		// Several messages of one epoch, or a repeat
+		return Gap{}, false
+	}
+	st.last = ms
+	if step > wrap/2 {
+		// The stream went back in time, e.g. a different base after
+		// reconnecting
+		return Gap{}, false
+	}
+	if st.interval == 0 || step < st.interval {
+		st.interval = step
+		return Gap{}, false
+	}
+	if step < st.interval*3/2 {
+		return Gap{}, false
+	}
+
+	gap := Gap{
+		Message:  msg.Number,
+		Duration: time.Duration(step) * time.Millisecond,
+		Expected: time.Duration(st.interval) * time.Millisecond,
+	}
+	c.Gaps++
+	c.Missed += int((step+st.interval/2)/st.interval) - 1
+	if gap.Duration > c.Longest {
+		c.Longest = gap.Duration
+	}
+	return gap, true
+}
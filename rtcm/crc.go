@@ -0,0 +1,30 @@
+package rtcm
+
+// crc24qPoly is the CRC-24Q generator polynomial used by RTCM3
+const crc24qPoly = 0x1864CFB
+
+var crc24qTable = makeCRC24QTable()
+
+func makeCRC24QTable() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 16
+		for j := 0; j < 8; j++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24qPoly
+			}
+		}
+		table[i] = crc & 0xFFFFFF
+	}
+	return table
+}
+
+// CRC24Q computes the 24-bit Qualcomm CRC over data
+func CRC24Q(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = ((crc << 8) & 0xFFFFFF) ^ crc24qTable[byte(crc>>16)^b]
+	}
+	return crc
+}
@@ -0,0 +1,185 @@
+// Package rtcm extracts RTCM 3 messages from a byte stream.
+package rtcm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	// Preamble marks the start of every RTCM3 frame
+	Preamble = 0xD3
+
+	headerLen = 3
+	crcLen    = 3
+	// MaxPayload is the largest payload the 10-bit length field allows
+	MaxPayload = 1023
+)
+
+// Message is a complete, CRC-validated RTCM3 frame
+type Message struct {
+	// Number is the message type (DF002)
+	Number int
+	// Payload is the message body without header and CRC
+	Payload []byte
+	// Frame is the whole frame as received, including header and CRC
+	Frame []byte
+}
+
+// Framer scans a byte stream for RTCM3 frames. Bytes that are not part of
+// a valid frame are skipped, so corrupt data never reaches the caller.
+type Framer struct {
+	buf    []byte
+	offset int64 // Stream offset of buf[0]
+
+	skipped   int   // Bytes in the current run of skipped data
+	skipStart int64 // Stream offset of the run
+
+	// Discarded counts bytes skipped while searching for a valid frame
+	Discarded int64
+	// CRCErrors counts candidate frames rejected by the CRC check
+	CRCErrors int64
+
+	// OnError, when set, is called for every candidate frame failing the
+	// CRC check and for every run of skipped bytes, once the next valid
+	// frame ends it
+	OnError func(FrameError)
+	// OnSkip, when set, receives the bytes skipped outside valid frames,
+	// such as NMEA sentences interleaved on the same serial line. data is
+	// only valid during the call.
+	OnSkip func(data []byte)
+}
+
+// FrameError describes data the framer rejected
+type FrameError struct {
+	// Offset is the position in the stream of the first rejected byte
+	Offset int64
+	// CRC is set for a candidate frame failing the CRC check, with the
+	// message type and payload length from its header. Otherwise Length
+	// bytes of data that are not a frame were skipped.
+	CRC    bool
+	Number int
+	Length int
+}
+
+func (e FrameError) Error() string {
+	if e.CRC {
+		return fmt.Sprintf("CRC error in message %d of %d bytes at offset %d", e.Number, e.Length, e.Offset)
+	}
+	return fmt.Sprintf("skipped %d bytes at offset %d", e.Length, e.Offset)
+}
+
+func NewFramer() *Framer {
+	return &Framer{}
+}
+
+// Feed appends data to the stream and returns the messages it completes.
+// Incomplete trailing frames are kept until more data arrives.
+func (f *Framer) Feed(data []byte) []Message {
+	f.buf = append(f.buf, data...)
+
+	var msgs []Message
+	for {
+		i := bytes.IndexByte(f.buf, Preamble)
+		if i < 0 {
+			f.discard(len(f.buf))
+			break
+		}
+		if i > 0 {
+			f.discard(i)
+		}
+		if len(f.buf) < headerLen {
+			break
+		}
+
+		// The six bits after the preamble are reserved and always zero
+		if f.buf[1]&0xFC != 0 {
+			f.skip()
+			continue
+		}
+
+		length := int(f.buf[1]&0x03)<<8 | int(f.buf[2])
+		total := headerLen + length + crcLen
+		if len(f.buf) < total {
+			break
+		}
+
+		frame := f.buf[:total]
+		want := uint32(frame[total-3])<<16 | uint32(frame[total-2])<<8 | uint32(frame[total-1])
+		if CRC24Q(frame[:headerLen+length]) != want {
+			f.CRCErrors++
+			if f.OnError != nil {
+				f.OnError(FrameError{Offset: f.offset, CRC: true, Number: MessageNumber(frame[headerLen:]), Length: length})
+			}
+			f.skip()
+			continue
+		}
+		f.endSkip()
+
+		msg := Message{Frame: append([]byte(nil), frame...)}
+		msg.Payload = msg.Frame[headerLen : headerLen+length]
+		msg.Number = MessageNumber(msg.Payload)
+		msgs = append(msgs, msg)
+
+		f.buf = f.buf[total:]
+		f.offset += int64(total)
+	}
+
+	// Keep the pending bytes at the start of the buffer so it does not
+	// creep forward through memory
+	f.buf = append(f.buf[:0:0], f.buf...)
+	return msgs
+}
+
+// Pending returns the number of buffered bytes of an incomplete frame. It
+// is zero when the data fed so far ended on a frame boundary.
+func (f *Framer) Pending() int {
+	return len(f.buf)
+}
+
+// skip drops the current preamble byte to resynchronise on the next one
+func (f *Framer) skip() {
+	f.discard(1)
+}
+
+// discard drops n bytes from the buffer as part of the current skipped run
+func (f *Framer) discard(n int) {
+	if f.skipped == 0 {
+		f.skipStart = f.offset
+	}
+	f.skipped += n
+	f.Discarded += int64(n)
+	if f.OnSkip != nil {
+		f.OnSkip(f.buf[:n])
+	}
+	f.buf = f.buf[n:]
+	f.offset += int64(n)
+}
+
+// endSkip reports the run of skipped bytes before a valid frame
+func (f *Framer) endSkip() {
+	if f.skipped > 0 && f.OnError != nil {
+		f.OnError(FrameError{Offset: f.skipStart, Length: f.skipped})
+	}
+	f.skipped = 0
+}
+
+// Encode wraps a payload in an RTCM3 frame with header and CRC. An empty
+// payload yields the zero-length frame commonly used as a keepalive.
+func Encode(payload []byte) []byte {
+	length := len(payload)
+	frame := make([]byte, 0, headerLen+length+crcLen)
+	frame = append(frame, Preamble, byte(length>>8)&0x03, byte(length))
+	frame = append(frame, payload...)
+	crc := CRC24Q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// MessageNumber returns the message type from the first 12 bits of a
+// payload, or 0 if the payload is too short
+func MessageNumber(payload []byte) int {
+	if len(payload) < 2 {
+		return 0
+	}
+	return int(payload[0])<<4 | int(payload[1])>>4
+}
@@ -0,0 +1,184 @@
+package rtcm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+// captured are frames cut from rtcm_data.bin_20250429_182941, a capture
+// of a base sending MSM7, ephemeris and NMEA on the same stream
+var captured = []struct {
+	name   string
+	number int
+	frame  string
+}{
+	{"Galileo MSM7", 1097, "d30016449d07345b5202002000000000000000000000000000432e5a"},
+	{"QZSS MSM7", 1117, "d3001645dd07345b5200002000000000000000000000000000b88051"},
+	{"GLONASS ephemeris", 1020, "d3002d3fc0518fecbfa6490f01573f049d007132ee217111e19455a261d1801d1028a28123cacf200000008200000c00f1c322"},
+	{"GPS ephemeris", 1019, "d3003d3fb613c07d1f0a367d000040c9e0200afd993e4800433ec5fdd90882e51b0beca10d5977367dffc8d928e4390064260e71bb20952b16b82bff9f910500867b32"},
+}
+
+// nmea is a sentence the receiver interleaves with the RTCM frames
+const nmea = "$PAIR001,33359,2*36\r\n"
+
+func frameBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCapturedFrames(t *testing.T) {
+	for _, tt := range captured {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := frameBytes(t, tt.frame)
+			n := len(frame)
+			want := uint32(frame[n-3])<<16 | uint32(frame[n-2])<<8 | uint32(frame[n-1])
+			if got := CRC24Q(frame[:n-3]); got != want {
+				t.Errorf("CRC24Q = %06x, want %06x", got, want)
+			}
+
+			msgs := NewFramer().Feed(frame)
+			if len(msgs) != 1 {
+				t.Fatalf("got %d messages, want 1", len(msgs))
+			}
+			msg := msgs[0]
+			if msg.Number != tt.number || MessageNumber(msg.Payload) != tt.number {
+				t.Errorf("message number = %d, want %d", msg.Number, tt.number)
+			}
+			if !bytes.Equal(msg.Frame, frame) || !bytes.Equal(msg.Payload, frame[3:n-3]) {
+				t.Errorf("frame or payload not returned as received")
+			}
+			if got := Encode(msg.Payload); !bytes.Equal(got, frame) {
+				t.Errorf("Encode = %x, want %x", got, frame)
+			}
+		})
+	}
+}
+
+func TestCRCError(t *testing.T) {
+	for _, tt := range captured {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := frameBytes(t, tt.frame)
+			frame[len(frame)/2] ^= 0x01
+			var errs []FrameError
+			f := NewFramer()
+			f.OnError = func(e FrameError) { errs = append(errs, e) }
+			if msgs := f.Feed(frame); len(msgs) != 0 {
+				t.Fatalf("corrupt frame returned %d messages", len(msgs))
+			}
+			if f.CRCErrors != 1 {
+				t.Errorf("CRCErrors = %d, want 1", f.CRCErrors)
+			}
+			if len(errs) == 0 || !errs[0].CRC || errs[0].Number != tt.number {
+				t.Errorf("errors reported = %+v, want a CRC error in message %d", errs, tt.number)
+			}
+		})
+	}
+}
+
+func TestMessageNumber(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    int
+	}{
+		{nil, 0},
+		{[]byte{0x3e}, 0},
+		{[]byte{0x3e, 0xd0}, 1005},
+		{[]byte{0x43, 0x50, 0xff}, 1077},
+		{[]byte{0xff, 0xf0}, 4095},
+	}
+	for _, tt := range tests {
+		if got := MessageNumber(tt.payload); got != tt.want {
+			t.Errorf("MessageNumber(%x) = %d, want %d", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestResync(t *testing.T) {
+	first := frameBytes(t, captured[0].frame)
+	second := frameBytes(t, captured[2].frame)
+	corrupt := frameBytes(t, captured[1].frame)
+	corrupt[10] ^= 0xff
+	tests := []struct {
+		name string
+		junk []byte // Between the two frames
+	}{
+		{"garbage", []byte{0x00, 0x13, 0x37, 0xff}},
+		{"interleaved NMEA", []byte(nmea)},
+		{"preamble in garbage", []byte{0xd3, 0xff, 0x12, 0xd3}},
+		{"corrupt frame", corrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var skipped []byte
+			f := NewFramer()
+			f.OnSkip = func(data []byte) { skipped = append(skipped, data...) }
+			stream := append(append(append([]byte(nil), first...), tt.junk...), second...)
+			msgs := f.Feed(stream)
+			if len(msgs) != 2 || msgs[0].Number != captured[0].number || msgs[1].Number != captured[2].number {
+				t.Fatalf("got %d messages, want %d then %d", len(msgs), captured[0].number, captured[2].number)
+			}
+			if !bytes.Equal(skipped, tt.junk) || f.Discarded != int64(len(tt.junk)) {
+				t.Errorf("skipped %q (%d bytes discarded), want %q", skipped, f.Discarded, tt.junk)
+			}
+			if f.Pending() != 0 {
+				t.Errorf("Pending = %d after a whole frame", f.Pending())
+			}
+		})
+	}
+}
+
+func TestSplitFeed(t *testing.T) {
+	frame := frameBytes(t, captured[3].frame)
+	for split := 1; split < len(frame); split++ {
+		f := NewFramer()
+		if msgs := f.Feed(frame[:split]); len(msgs) != 0 {
+			t.Fatalf("split at %d: partial frame returned a message", split)
+		}
+		if f.Pending() != split {
+			t.Errorf("split at %d: Pending = %d", split, f.Pending())
+		}
+		msgs := f.Feed(frame[split:])
+		if len(msgs) != 1 || !bytes.Equal(msgs[0].Frame, frame) {
+			t.Fatalf("split at %d: frame not reassembled", split)
+		}
+		if f.Discarded != 0 || f.CRCErrors != 0 {
+			t.Errorf("split at %d: discarded %d bytes, %d CRC errors", split, f.Discarded, f.CRCErrors)
+		}
+	}
+}
+
+// TestCapture frames a whole capture, at once and in small reads, and
+// checks the counts against an independent scan of the file
+func TestCapture(t *testing.T) {
+	data, err := os.ReadFile("../rtcm_data.bin_20250429_182941")
+	if err != nil {
+		t.Skipf("capture not available: %v", err)
+	}
+	want := map[int]int{1019: 9, 1020: 38, 1042: 18, 1077: 13, 1087: 13, 1097: 13, 1117: 13, 1127: 13, 3335: 13}
+	for _, size := range []int{len(data), 7, 1} {
+		f := NewFramer()
+		counts := make(map[int]int)
+		for off := 0; off < len(data); off += size {
+			for _, msg := range f.Feed(data[off:min(off+size, len(data))]) {
+				counts[msg.Number]++
+			}
+		}
+		for number, n := range want {
+			if counts[number] != n {
+				t.Errorf("reads of %d bytes: %d messages %d, want %d", size, counts[number], number, n)
+			}
+		}
+		if len(counts) != len(want) {
+			t.Errorf("reads of %d bytes: message types %v, want %v", size, counts, want)
+		}
+		if f.Discarded+int64(f.Pending()) != 11863 {
+			t.Errorf("reads of %d bytes: %d bytes skipped and %d pending, want 11863 in all", size, f.Discarded, f.Pending())
+		}
+	}
+}
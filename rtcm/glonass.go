@@ -0,0 +1,47 @@
+package rtcm
+
+import "fmt"
+
+// GLONASSBiases is the GLONASS code-phase bias message 1230
+type GLONASSBiases struct {
+	StationID int
+	// Aligned is set when the observations are already corrected for the
+	// biases
+	Aligned bool
+	// Biases in metres by signal, "L1 C/A", "L1 P", "L2 C/A" and "L2 P",
+	// for the signals the station reports
+	Biases map[string]float64
+}
+
+// glonassBiasSignals names the bits of the 1230 signal mask, most
+// significant first
+var glonassBiasSignals = []string{"L1 C/A", "L1 P", "L2 C/A", "L2 P"}
+
+// ParseGLONASSBiases decodes the payload of a 1230 message
+func ParseGLONASSBiases(payload []byte) (GLONASSBiases, error) {
+	var b GLONASSBiases
+	if number := MessageNumber(payload); number != 1230 {
+		return b, fmt.Errorf("message %d is not a GLONASS bias message", number)
+	}
+	if len(payload) < 4 {
+		return b, fmt.Errorf("message 1230 too short: %d bytes", len(payload))
+	}
+
+	b.StationID = int(bits(payload, 12, 12))
+	b.Aligned = bits(payload, 24, 1) == 1
+	// Three reserved bits precede the signal mask
+	mask := bits(payload, 28, 4)
+	b.Biases = make(map[string]float64)
+	pos := 32
+	for i, name := range glonassBiasSignals {
+		if mask&(1<<(3-i)) == 0 {
+			continue
+		}
+		if len(payload)*8 < pos+16 {
+			return b, fmt.Errorf("message 1230 too short: %d bytes", len(payload))
+		}
+		b.Biases[name] = float64(signedBits(payload, pos, 16)) * 0.02
+		pos += 16
+	}
+	return b, nil
+}
@@ -0,0 +1,75 @@
+package rtcm
+
+import "fmt"
+
+// MSMHeader is the header common to the multiple signal messages 1071-1137
+type MSMHeader struct {
+	Number    int
+	StationID int
+	// Epoch is the observation time in milliseconds of the GNSS week, or
+	// of the GLONASS day with the day of week in GLONASSDay
+	Epoch       uint32
+	GLONASSDay  int
+	MultipleMsg bool // More MSM messages follow for the same epoch
+	IODS        int  // Issue of data station
+	// Satellites and Signals are the IDs, from 1, set in the masks
+	Satellites []int
+	Signals    []int
+	// Cells is the number of satellite and signal pairs observed
+	Cells int
+}
+
+// IsMSM reports whether number is a multiple signal message type
+func IsMSM(number int) bool {
+	return number >= 1071 && number <= 1137 && number%10 >= 1 && number%10 <= 7
+}
+
+// msmHeaderBits is the header length up to the cell mask
+const msmHeaderBits = 169
+
+// ParseMSMHeader decodes the header of an MSM message
+func ParseMSMHeader(payload []byte) (MSMHeader, error) {
+	var h MSMHeader
+	h.Number = MessageNumber(payload)
+	if !IsMSM(h.Number) {
+		return h, fmt.Errorf("message %d is not an MSM message", h.Number)
+	}
+	if len(payload)*8 < msmHeaderBits {
+		return h, fmt.Errorf("message %d too short: %d bytes", h.Number, len(payload))
+	}
+
+	h.StationID = int(bits(payload, 12, 12))
+	if h.Number >= 1081 && h.Number <= 1087 {
+		h.GLONASSDay = int(bits(payload, 24, 3))
+		h.Epoch = uint32(bits(payload, 27, 27))
+	} else {
+		h.Epoch = uint32(bits(payload, 24, 30))
+	}
+	h.MultipleMsg = bits(payload, 54, 1) == 1
+	h.IODS = int(bits(payload, 55, 3))
+	// Reserved, clock steering, external clock and smoothing bits precede
+	// the satellite and signal masks
+	h.Satellites = maskIDs(bits(payload, 73, 64), 64)
+	h.Signals = maskIDs(bits(payload, 137, 32), 32)
+
+	n := len(h.Satellites) * len(h.Signals)
+	if n > 64 || len(payload)*8 < msmHeaderBits+n {
+		return h, fmt.Errorf("message %d has an invalid cell mask of %d cells", h.Number, n)
+	}
+	for i := range n {
+		h.Cells += int(bits(payload, msmHeaderBits+i, 1))
+	}
+	return h, nil
+}
+
+// maskIDs returns the 1-based positions of the bits set in an n bit mask,
+// most significant first
+func maskIDs(mask uint64, n int) []int {
+	var ids []int
+	for i := range n {
+		if mask&(1<<(n-1-i)) != 0 {
+			ids = append(ids, i+1)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,157 @@
+package rtcm
+
+import (
+	"fmt"
+	"math"
+)
+
+// StationARP is the reference station position carried by messages 1005
+// and 1006
+type StationARP struct {
+	StationID int
+	ITRFYear  int
+	// X, Y and Z are the antenna reference point in ECEF metres
+	X, Y, Z float64
+	// Height is the antenna height above the marker, 1006 only
+	Height float64
+}
+
+// ParseStationARP decodes the payload of a 1005 or 1006 message
+func ParseStationARP(payload []byte) (StationARP, error) {
+	var arp StationARP
+	number := MessageNumber(payload)
+	size := 19
+	if number == 1006 {
+		size = 21
+	} else if number != 1005 {
+		return arp, fmt.Errorf("message %d is not a station ARP message", number)
+	}
+	if len(payload) < size {
+		return arp, fmt.Errorf("message %d too short: %d bytes", number, len(payload))
+	}
+
+	arp.StationID = int(bits(payload, 12, 12))
+	arp.ITRFYear = int(bits(payload, 24, 6))
+	// Constellation and reference station indicator flags precede X,
+	// oscillator, reserved and quarter cycle bits precede Y and Z
+	arp.X = float64(signedBits(payload, 34, 38)) * 0.0001
+	arp.Y = float64(signedBits(payload, 74, 38)) * 0.0001
+	arp.Z = float64(signedBits(payload, 114, 38)) * 0.0001
+	if number == 1006 {
+		arp.Height = float64(bits(payload, 152, 16)) * 0.0001
+	}
+	return arp, nil
+}
+
+// Descriptor is the antenna and receiver description of message 1033
+type Descriptor struct {
+	StationID      int
+	Antenna        string
+	AntennaSetup   int
+	AntennaSerial  string
+	Receiver       string
+	Firmware       string
+	ReceiverSerial string
+}
+
+// ParseDescriptor decodes the payload of a 1033 message
+func ParseDescriptor(payload []byte) (Descriptor, error) {
+	var d Descriptor
+	if number := MessageNumber(payload); number != 1033 {
+		return d, fmt.Errorf("message %d is not a descriptor message", number)
+	}
+	if len(payload) < 4 {
+		return d, fmt.Errorf("message 1033 too short: %d bytes", len(payload))
+	}
+	d.StationID = int(bits(payload, 12, 12))
+
+	// Each string is a byte count followed by that many characters
+	pos := 3
+	short := false
+	text := func() string {
+		if pos >= len(payload) || pos+1+int(payload[pos]) > len(payload) {
+			short = true
+			return ""
+		}
+		n := int(payload[pos])
+		s := string(payload[pos+1 : pos+1+n])
+		pos += 1 + n
+		return s
+	}
+	d.Antenna = text()
+	if !short && pos < len(payload) {
+		d.AntennaSetup = int(payload[pos])
+		pos++
+	}
+	d.AntennaSerial = text()
+	d.Receiver = text()
+	d.Firmware = text()
+	d.ReceiverSerial = text()
+	if short {
+		return d, fmt.Errorf("message 1033 too short: %d bytes", len(payload))
+	}
+	return d, nil
+}
+
+// StationID returns the reference station ID (DF003) of the message types
+// that carry one right after the message number: observations 1001-1004
+// and 1009-1012, station messages 1005-1008, 1013, 1029, 1033, 1230 and
+// the MSM messages. Ephemerides and other types report false.
+func StationID(payload []byte) (int, bool) {
+	n := MessageNumber(payload)
+	switch {
+	case n >= 1001 && n <= 1013, n == 1029, n == 1033, n == 1230, IsMSM(n):
+	default:
+		return 0, false
+	}
+	if len(payload) < 3 {
+		return 0, false
+	}
+	return int(bits(payload, 12, 12)), true
+}
+
+// bits reads n unsigned bits starting at bit pos, most significant first
+func bits(data []byte, pos, n int) uint64 {
+	var v uint64
+	for i := pos; i < pos+n; i++ {
+		v = v<<1 | uint64(data[i/8]>>(7-i%8)&1)
+	}
+	return v
+}
+
+// signedBits reads n bits as a two's complement integer
+func signedBits(data []byte, pos, n int) int64 {
+	v := bits(data, pos, n)
+	if v&(1<<(n-1)) != 0 {
+		return int64(v) - 1<<n
+	}
+	return int64(v)
+}
+
+// WGS84 ellipsoid
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+)
+
+// Geodetic converts the ECEF antenna reference point to WGS84 latitude and
+// longitude in degrees and ellipsoidal height in metres
+func (a StationARP) Geodetic() (lat, lon, height float64) {
+	e2 := wgs84F * (2 - wgs84F)
+	p := math.Hypot(a.X, a.Y)
+	lon = math.Atan2(a.Y, a.X)
+	if p < 1e-9 {
+		b := wgs84A * (1 - wgs84F)
+		return math.Copysign(90, a.Z), 0, math.Abs(a.Z) - b
+	}
+
+	// Iterate the latitude, which converges to millimetres in a few steps
+	phi := math.Atan2(a.Z, p*(1-e2))
+	for range 10 {
+		sin := math.Sin(phi)
+		n := wgs84A / math.Sqrt(1-e2*sin*sin)
+		height = p/math.Cos(phi) - n
+		phi = math.Atan2(a.Z, p*(1-e2*n/(n+height)))
+	}
+	return phi * 180 / math.Pi, lon * 180 / math.Pi, height
+}
@@ -0,0 +1,81 @@
+package ntrip
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/tarm/serial"
+)
+
+// checkPort checks if a serial port exists and is accessible
+func checkPort(port string) bool {
+	_, err := os.Stat(port)
+	return err == nil
+}
+
+// findActivePort tries to find an active USB port from usb0 to usb3
+func findActivePort() (string, error) {
+	ports := []string{"/dev/ttyUSB0", "/dev/ttyUSB1", "/dev/ttyUSB2", "/dev/ttyUSB3"}
+
+	for _, port := range ports {
+		if checkPort(port) {
+			slog.Info("Found active port", "port", port)
+			return port, nil
+		}
+	}
+
+	return "", fmt.Errorf("no active USB port found")
+}
+
+// openSerial opens the serial port of a source
+func openSerial(src *source) (io.ReadCloser, error) {
+	// Try to find an active port if not specified in config
+	port := src.config.Port
+	if port == "" {
+		var err error
+		port, err = findActivePort()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sc := src.config
+	sc.Port = port
+	sp, err := OpenSerialPort(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Serial port opened", "source", src.name, "port", port, "baud", src.config.BaudRate)
+	return sp, nil
+}
+
+// OpenSerialPort opens the serial port described by the Port, BaudRate,
+// DataBits, StopBits and Parity fields of sc
+func OpenSerialPort(sc SerialConfig) (io.ReadWriteCloser, error) {
+	c := &serial.Config{
+		Name:     sc.Port,
+		Baud:     sc.BaudRate,
+		Size:     byte(sc.DataBits),
+		StopBits: serial.StopBits(sc.StopBits),
+	}
+
+	switch sc.Parity {
+	case "N":
+		c.Parity = serial.ParityNone
+	case "E":
+		c.Parity = serial.ParityEven
+	case "O":
+		c.Parity = serial.ParityOdd
+	default:
+		return nil, fmt.Errorf("invalid parity setting: %s", sc.Parity)
+	}
+
+	sp, err := serial.OpenPort(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial port %s: %v", sc.Port, err)
+	}
+	return sp, nil
+}
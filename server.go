@@ -0,0 +1,971 @@
+// Package ntrip implements an NTRIP caster serving RTCM corrections from
+// serial or TCP receivers, and a client for pulling corrections from a caster.
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// keepaliveFrame is written to idle clients to keep firewalls from closing
+// the connection, receivers ignore the empty message
+var keepaliveFrame = rtcm.Encode(nil)
+
+// Server is an NTRIP caster broadcasting its sources to subscribed clients
+type Server struct {
+	config    Config
+	port      int
+	listeners []net.Listener
+	mu        sync.RWMutex
+	sources   map[string]*source
+	mounts    map[string]*mountpoint
+	admin     *http.Server
+	metrics   *http.Server
+	started   time.Time
+	draining  bool // Set by Drain, no new clients are accepted
+
+	// Open connections in total and per remote IP, and how many were
+	// let in or turned away by the limits
+	active   int
+	perIP    map[string]int
+	accepted int64
+	rejected int64
+
+	// ctx is cancelled by Stop or by the context passed to Start, and wg
+	// tracks every goroutine the server runs so Wait can tell when they
+	// have all returned
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// mountpoint is a stream served to clients, holding the set of clients
+// subscribed to it
+type mountpoint struct {
+	name    string
+	users   []string
+	clients map[net.Conn]*clientConn
+
+	bytesIn   int64     // Source data broadcast to the mountpoint
+	bytesSent int64     // Bytes written to its clients
+	lastData  time.Time // When data last arrived
+	rate      rateMeter // Bitrate of the source data
+
+	// With a type filter the source is reframed and only matching frames
+	// are forwarded, bytes outside RTCM frames are dropped
+	types     map[int]bool // Allowed or denied message numbers
+	allow     bool         // Whether types lists allowed numbers
+	framer    *rtcm.Framer // Nil without a filter or priming
+	forwarded int64        // Frames passed by the filter
+	filtered  int64        // Frames removed by the filter
+
+	// With priming the latest station messages are kept and sent to new
+	// clients right after the header
+	prime  bool
+	primed map[int][]byte // Last frame per primeTypes entry
+}
+
+// primeTypes are the messages cached for new clients, in sending order:
+// the station position, the antenna descriptor and the GLONASS biases
+var primeTypes = []int{1005, 1006, 1033, 1230}
+
+// configure installs the message type filter and priming of mc, keeping
+// an existing framer so a reload does not lose a partial frame
+func (m *mountpoint) configure(mc MountpointConfig) {
+	list, allow := mc.DenyTypes, false
+	if len(mc.AllowTypes) > 0 {
+		list, allow = mc.AllowTypes, true
+	}
+	m.types = nil
+	if len(list) > 0 {
+		m.types = make(map[int]bool, len(list))
+		for _, n := range list {
+			m.types[n] = true
+		}
+		m.allow = allow
+	}
+	m.prime = mc.PrimeOnConnect
+	if !m.prime {
+		m.primed = nil
+	}
+	switch {
+	case m.types == nil && !m.prime:
+		m.framer = nil
+	case m.framer == nil:
+		m.framer = rtcm.NewFramer()
+	}
+}
+
+// frames runs data through the mountpoint's framer, caching station
+// messages for priming, and returns what to forward: the complete frames
+// passing the type filter, or data itself without a filter. The caller
+// holds s.mu.
+func (m *mountpoint) frames(data []byte) []byte {
+	var out []byte
+	for _, msg := range m.framer.Feed(data) {
+		if m.types != nil && m.types[msg.Number] != m.allow {
+			m.filtered++
+			continue
+		}
+		if m.types != nil {
+			m.forwarded++
+			out = append(out, msg.Frame...)
+		}
+		if m.prime && slices.Contains(primeTypes, msg.Number) {
+			if m.primed == nil {
+				m.primed = make(map[int][]byte)
+			}
+			m.primed[msg.Number] = msg.Frame
+		}
+	}
+	if m.types == nil {
+		return data
+	}
+	return out
+}
+
+// primer returns the cached station messages for a new client. The
+// caller holds s.mu.
+func (m *mountpoint) primer() []byte {
+	var out []byte
+	for _, n := range primeTypes {
+		out = append(out, m.primed[n]...)
+	}
+	return out
+}
+
+// bitrate returns the rate of source data in bits per second over about
+// the last ten seconds, 0 before any data has arrived. The caller holds
+// s.mu.
+func (m *mountpoint) bitrate() int {
+	return m.rate.bitrate(time.Now())
+}
+
+// clientConn is a connected rover with its own queue of outgoing data,
+// drained by a dedicated writer goroutine
+type clientConn struct {
+	conn      net.Conn
+	id        string       // Connection ID, as in the logs
+	user      string       // Authenticated username, if any
+	log       *slog.Logger // Tagged with the connection ID and address
+	mount     *mountpoint
+	queue     chan []byte
+	connected time.Time
+	bytesSent int64
+	lastWrite time.Time
+	chunked   bool // Frame writes with chunked transfer encoding
+	drained   bool // Queue closed by Drain, the writer ends the stream
+	kicked    bool // Disconnected on admin request
+}
+
+// NewServer creates a caster for the given configuration, filling in
+// defaults for unset options
+func NewServer(config Config) *Server {
+	config = withDefaults(config)
+	s := &Server{
+		config:  config,
+		port:    config.Server.Port,
+		sources: make(map[string]*source),
+		mounts:  make(map[string]*mountpoint),
+		perIP:   make(map[string]int),
+	}
+
+	s.sources[defaultSource] = newSource(defaultSource, config.Serial)
+	for _, sc := range config.Sources {
+		s.sources[sc.Name] = newSource(sc.Name, sc.SerialConfig)
+	}
+	s.setMounts(config)
+
+	return s
+}
+
+// withDefaults fills in unset options and merges the legacy
+// authentication block into the user table
+func withDefaults(config Config) Config {
+	if config.Server.ClientBufferSize <= 0 {
+		config.Server.ClientBufferSize = defaultClientBufferSize
+	}
+	if config.Server.Port == 0 {
+		config.Server.Port = defaultPort
+	}
+	if config.Server.SlowClientPolicy == "" {
+		config.Server.SlowClientPolicy = policyDrop
+	}
+	if config.Server.WriteTimeout == 0 {
+		config.Server.WriteTimeout = defaultWriteTimeout
+	}
+	if config.Server.DrainTimeout == 0 {
+		config.Server.DrainTimeout = defaultDrainTimeout
+	}
+	if config.Server.Banner == "" {
+		config.Server.Banner = defaultBanner
+	}
+	if config.Server.ReadBufferSize <= 0 {
+		config.Server.ReadBufferSize = defaultReadBufferSize
+	}
+
+	if config.Authentication.Enabled && config.Authentication.Username != "" {
+		if config.Server.Users == nil {
+			config.Server.Users = make(map[string]string)
+		}
+		config.Server.Users[config.Authentication.Username] = config.Authentication.Password
+	}
+	return config
+}
+
+// settings returns the current configuration, which Reload may replace
+func (s *Server) settings() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Start opens the sources and begins accepting clients. The server runs
+// until ctx is cancelled or Stop is called.
+func (s *Server) Start(ctx context.Context) error {
+	if s.port < 1 || s.port > 65535 {
+		return fmt.Errorf("invalid server port %d", s.port)
+	}
+	return s.start(ctx, s.listen)
+}
+
+// Serve is Start on an already open listener instead of the configured
+// ports, such as an ephemeral 127.0.0.1:0 one in tests or a socket handed
+// over by a service manager. The server closes l when it stops.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	return s.start(ctx, func() error {
+		s.listeners = append(s.listeners, l)
+		slog.Info("NTRIP server started", "addr", l.Addr().String(), "version", Version)
+		return nil
+	})
+}
+
+// start opens the sources, then calls listen to set up s.listeners
+func (s *Server) start(ctx context.Context, listen func() error) error {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	// Open every source in use. Sources set to wait for their port are
+	// retried in the background instead of failing startup.
+	var waiting []*source
+	for _, src := range s.sources {
+		if len(src.mounts) == 0 || src.config.OnDemand {
+			continue
+		}
+		if err := s.openSource(s.ctx, src); err != nil {
+			if src.config.WaitForPort {
+				slog.Warn("Source not available yet, retrying in the background", "source", src.name, "err", err)
+				waiting = append(waiting, src)
+				continue
+			}
+			s.cancel()
+			s.shutdown()
+			return err
+		}
+	}
+
+	if err := listen(); err != nil {
+		s.cancel()
+		s.shutdown()
+		return fmt.Errorf("failed to start server: %v", err)
+	}
+	s.started = time.Now()
+
+	s.startAdmin()
+
+	// Start reading from the sources
+	for _, src := range s.sources {
+		if src.conn != nil || (src.config.OnDemand && len(src.mounts) > 0) {
+			src.running = true
+			s.spawn(func() { s.readSource(src) })
+		}
+	}
+	for _, src := range waiting {
+		src.running = true
+		s.spawn(func() {
+			if s.reconnectSource(s.ctx, src) {
+				s.readSource(src)
+			}
+		})
+	}
+	// Start accepting connections
+	for _, l := range s.listeners {
+		s.spawn(func() { s.acceptConnections(l) })
+	}
+
+	// Closing everything unblocks the goroutines once the server is done
+	context.AfterFunc(s.ctx, s.shutdown)
+
+	return nil
+}
+
+// listen opens the caster port, plaintext or with TLS when a certificate
+// is configured. With a separate TLS port both are opened, so legacy
+// rovers can keep connecting without TLS.
+func (s *Server) listen() error {
+	if path, ok := unixSocket(s.config.Server.Host); ok {
+		return s.listenUnix(path)
+	}
+	// An empty host or "::" listens on every interface, IPv4 and IPv6 alike
+	host := strings.Trim(s.config.Server.Host, "[]")
+	tlsConfig := s.config.Server.TLS
+	useTLS := tlsConfig.CertFile != "" || tlsConfig.KeyFile != ""
+
+	var cert tls.Certificate
+	if useTLS {
+		var err error
+		cert, err = tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+	}
+	open := func(port int, secure bool) error {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return err
+		}
+		if secure {
+			l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+		}
+		s.listeners = append(s.listeners, l)
+		slog.Info("NTRIP server started", "addr", l.Addr().String(), "tls", secure, "version", Version)
+		return nil
+	}
+
+	switch {
+	case !useTLS:
+		return open(s.port, false)
+	case tlsConfig.Port == 0 || tlsConfig.Port == s.port:
+		return open(s.port, true)
+	default:
+		if tlsConfig.Port < 1 || tlsConfig.Port > 65535 {
+			return fmt.Errorf("invalid TLS port %d", tlsConfig.Port)
+		}
+		if err := open(s.port, false); err != nil {
+			return err
+		}
+		return open(tlsConfig.Port, true)
+	}
+}
+
+// listenUnix listens on a UNIX socket at path in place of the TCP port. A
+// socket left behind by a server that did not shut down cleanly is
+// replaced, a live one is an error. The file is removed when the listener
+// closes.
+func (s *Server) listenUnix(path string) error {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is in use by another server", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	s.listeners = append(s.listeners, l)
+	slog.Info("NTRIP server started", "addr", path, "tls", false, "version", Version)
+	return nil
+}
+
+// unixSocket returns the path of a "unix:/path/to.sock" address
+func unixSocket(addr string) (string, bool) {
+	return strings.CutPrefix(addr, "unix:")
+}
+
+// spawn runs f in a goroutine tracked by Wait
+func (s *Server) spawn(f func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+}
+
+// addClient subscribes a client to a mountpoint and starts its writer
+// goroutine
+func (s *Server) addClient(m *mountpoint, c *clientConn) {
+	s.mu.Lock()
+	c.mount = m
+	c.queue = make(chan []byte, s.config.Server.ClientBufferSize)
+	c.connected = time.Now()
+	c.lastWrite = c.connected
+	if prime := m.primer(); len(prime) > 0 {
+		c.queue <- prime
+	}
+	m.clients[c.conn] = c
+	s.notifyDemand(m)
+	s.mu.Unlock()
+
+	s.spawn(func() { s.writeClient(c) })
+}
+
+// removeClient closes a client's connection and unsubscribes it from its
+// mountpoint
+func (s *Server) removeClient(c *clientConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := c.mount.clients[c.conn]; ok {
+		close(c.queue)
+		delete(c.mount.clients, c.conn)
+		s.notifyDemand(c.mount)
+	}
+	c.conn.Close()
+}
+
+// Disconnect drops the client with connection ID id, as shown in the logs
+// and the admin /clients listing, and reports whether it was connected
+func (s *Server) Disconnect(id string) bool {
+	s.mu.Lock()
+	var found *clientConn
+	for _, m := range s.mounts {
+		for _, c := range m.clients {
+			if c.id == id {
+				found = c
+			}
+		}
+	}
+	if found != nil {
+		found.kicked = true
+	}
+	s.mu.Unlock()
+	if found == nil {
+		return false
+	}
+	found.log.Info("Disconnecting client on admin request")
+	s.removeClient(found)
+	return true
+}
+
+// writeClient drains a client's queue to its connection. When keepalives
+// are enabled, an empty RTCM frame is written whenever the queue has been
+// idle for the keepalive interval. A write that cannot complete within the
+// write timeout is handled by the slow client policy.
+func (s *Server) writeClient(c *clientConn) {
+	settings := s.settings().Server
+	interval := time.Duration(settings.KeepaliveInterval) * time.Second
+	writeTimeout := time.Duration(settings.WriteTimeout) * time.Second
+	var keepalive <-chan time.Time
+	var timer *time.Timer
+	if interval > 0 {
+		timer = time.NewTimer(interval)
+		defer timer.Stop()
+		keepalive = timer.C
+	}
+
+	for {
+		var data []byte
+		select {
+		case d, ok := <-c.queue:
+			if !ok {
+				if c.drained {
+					s.endStream(c)
+				}
+				return
+			}
+			data = d
+		case <-keepalive:
+			data = keepaliveFrame
+		}
+		if timer != nil {
+			timer.Reset(interval)
+		}
+
+		if c.chunked {
+			data = chunk(data)
+		}
+		stalls := 0
+		for {
+			if writeTimeout > 0 {
+				c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			}
+			n, err := writeAll(c.conn, data)
+
+			s.mu.Lock()
+			c.bytesSent += int64(n)
+			c.mount.bytesSent += int64(n)
+			if err == nil {
+				c.lastWrite = time.Now()
+			}
+			s.mu.Unlock()
+
+			if err == nil {
+				break
+			}
+			if !s.keepStuck(c, err) {
+				c.log.Warn("Error writing to client", "err", err)
+				s.removeClient(c)
+				return
+			}
+			// A client that takes nothing for several deadlines in a row
+			// has stopped reading
+			if n > 0 {
+				stalls = 0
+			} else if stalls++; stalls >= maxWriteStalls {
+				c.log.Warn("Client stopped reading, disconnecting", "timeout", writeTimeout, "stalls", stalls)
+				s.removeClient(c)
+				return
+			}
+			// The rest of the chunk goes out first so frames stay whole,
+			// meanwhile broadcast drops what the full queue cannot take
+			c.log.Warn("Client stuck, retrying write", "timeout", writeTimeout, "pending", len(data)-n)
+			data = data[n:]
+		}
+	}
+}
+
+// keepStuck reports whether a client whose write failed with err is
+// kept: under the drop policy a write timing out is retried after its
+// unwritten part, up to maxWriteStalls times when nothing was written. A
+// timed out TLS connection cannot be written again.
+func (s *Server) keepStuck(c *clientConn, err error) bool {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+	if _, ok := c.conn.(*tls.Conn); ok {
+		return false
+	}
+	return s.settings().Server.SlowClientPolicy == policyDrop
+}
+
+// maxWriteStalls is how many write deadlines in a row may pass without a
+// byte written before a stuck client is disconnected
+const maxWriteStalls = 3
+
+// writeAll writes data in full, continuing after short writes so a frame
+// is never cut off. A connection that stops accepting data fails once its
+// write deadline passes.
+func writeAll(conn net.Conn, data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		n, err := conn.Write(data[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// broadcast queues data for every client of a mountpoint without blocking.
+// A client whose queue is full either misses this chunk or is disconnected,
+// depending on the slow client policy.
+func (s *Server) broadcast(m *mountpoint, data []byte) {
+	data = append([]byte(nil), data...)
+	var slow []*clientConn
+
+	now := time.Now()
+	s.mu.Lock()
+	m.bytesIn += int64(len(data))
+	m.rate.add(len(data), now)
+	m.lastData = now
+	if m.framer != nil {
+		data = m.frames(data)
+	}
+	s.mu.Unlock()
+	if len(data) == 0 {
+		return
+	}
+
+	s.mu.RLock()
+	for _, c := range m.clients {
+		select {
+		case c.queue <- data:
+		default:
+			if s.config.Server.SlowClientPolicy == policyDisconnect {
+				c.log.Warn("Disconnecting slow client")
+				slow = append(slow, c)
+			} else {
+				c.log.Warn("Dropping data for slow client", "bytes", len(data))
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, c := range slow {
+		s.removeClient(c)
+	}
+
+	// While draining, clients are let go once the stream reaches a frame
+	// boundary. Filtered streams only ever carry whole frames.
+	s.mu.Lock()
+	if s.draining && m.framer != nil && (m.types != nil || m.framer.Pending() == 0) {
+		for conn, c := range m.clients {
+			c.drained = true
+			close(c.queue)
+			delete(m.clients, conn)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) acceptConnections(l net.Listener) {
+	var errs repeatLog
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil || s.isDraining() {
+				return
+			}
+			errs.log(slog.LevelError, "Error accepting connection", err, "addr", l.Addr().String())
+			continue
+		}
+		errs.reset()
+
+		tuneTCP(conn, time.Duration(s.settings().Server.TCPKeepalive)*time.Second)
+		id := newConnID()
+		log := slog.With("conn", id, "client", conn.RemoteAddr().String())
+		if reason, ok := s.admit(conn); !ok {
+			log.Warn("Rejecting connection", "reason", reason)
+			conn.Write([]byte(statusResponse(s.serverHeader(), NtripV1, http.StatusServiceUnavailable)))
+			conn.Close()
+			continue
+		}
+		log.Info("Client connected")
+		s.spawn(func() {
+			defer s.release(conn)
+			s.handleClient(conn, id, log)
+		})
+	}
+}
+
+// newConnID returns a short random ID identifying a connection in the logs
+func newConnID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tuneTCP disables Nagle's algorithm, so small RTCM bursts go out at once,
+// and sets the keepalive period of a TCP connection, possibly wrapped in
+// TLS. A zero period keeps the default, a negative one turns keepalives
+// off.
+func tuneTCP(conn net.Conn, keepalive time.Duration) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	tcp.SetNoDelay(true)
+	if keepalive < 0 {
+		tcp.SetKeepAlive(false)
+		return
+	}
+	tcp.SetKeepAlive(true)
+	if keepalive > 0 {
+		tcp.SetKeepAlivePeriod(keepalive)
+	}
+}
+
+// remoteIP returns the IP address part of a connection's remote address.
+// Clients on a UNIX socket all count as "unix".
+func remoteIP(conn net.Conn) string {
+	if conn.RemoteAddr().Network() == "unix" {
+		return "unix"
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// admit reserves a connection slot, failing with the reason when the
+// server wide or per-IP limit has been reached
+func (s *Server) admit(conn net.Conn) (string, bool) {
+	ip := remoteIP(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit := s.config.Server.MaxClients; limit > 0 && s.active >= limit {
+		s.rejected++
+		return "server full", false
+	}
+	if limit := s.config.Server.MaxClientsPerIP; limit > 0 && s.perIP[ip] >= limit {
+		s.rejected++
+		return "too many connections from address", false
+	}
+	s.active++
+	s.perIP[ip]++
+	s.accepted++
+	return "", true
+}
+
+// release frees the connection slot reserved by admit
+func (s *Server) release(conn net.Conn) {
+	ip := remoteIP(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.perIP[ip]--; s.perIP[ip] <= 0 {
+		delete(s.perIP, ip)
+	}
+}
+
+func (s *Server) handleClient(conn net.Conn, id string, log *slog.Logger) {
+	defer conn.Close()
+
+	// Don't wait forever for the request either
+	timeout := time.Duration(s.settings().Server.Timeout) * time.Second
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	readSize := s.settings().Server.ReadBufferSize
+	reader := bufio.NewReaderSize(conn, readSize)
+	req, err := readRequest(reader)
+	if err != nil {
+		if errors.Is(err, errMalformedRequest) {
+			log.Warn("Rejecting request", "err", err)
+			conn.Write([]byte(statusResponse(s.serverHeader(), NtripV1, http.StatusBadRequest)))
+		} else {
+			log.Warn("Error reading request", "err", err)
+		}
+		return
+	}
+	log.Info("Client request", "path", req.path, "version", req.version(), "agent", req.userAgent())
+
+	// The root path gets the sourcetable, as do unknown mountpoints for
+	// NTRIP v1 clients. NTRIP v2 clients get a 404 for the latter.
+	version := req.version()
+	s.mu.RLock()
+	m, ok := s.mounts[req.mountpoint()]
+	s.mu.RUnlock()
+	if !ok {
+		if req.mountpoint() != "" {
+			log.Info("Unknown mountpoint requested", "path", req.path)
+			if version == NtripV2 {
+				conn.Write([]byte(statusResponse(s.serverHeader(), version, http.StatusNotFound)))
+				return
+			}
+		}
+		if _, err := conn.Write([]byte(s.sourceTable(version))); err != nil {
+			log.Warn("Error sending sourcetable", "err", err)
+			return
+		}
+		log.Info("Sent sourcetable")
+		return
+	}
+
+	username, ok := s.authorize(m, req.headers["authorization"])
+	if !ok {
+		log.Warn("Client failed authentication", "mountpoint", m.name, "user", username)
+		realm := fmt.Sprintf("WWW-Authenticate: Basic realm=\"/%s\"", m.name)
+		conn.Write([]byte(statusResponse(s.serverHeader(), version, http.StatusUnauthorized, realm)))
+		return
+	}
+
+	// Send NTRIP header
+	settings := s.settings().Server
+	style := responseStyle(settings.Responses, req.userAgent())
+	chunked := version == NtripV2 && settings.Chunked
+	if _, err := conn.Write([]byte(streamResponse(s.serverHeader(), version, style, chunked))); err != nil {
+		log.Warn("Error sending header", "err", err)
+		return
+	}
+	log.Info("Client streaming", "mountpoint", m.name, "user", username, "chunked", chunked)
+	c := &clientConn{conn: conn, id: id, user: username, log: log, chunked: chunked}
+	s.addClient(m, c)
+	defer s.removeClient(c)
+
+	disconnected := func(args ...any) {
+		s.mu.RLock()
+		sent := c.bytesSent
+		s.mu.RUnlock()
+		log.Info("Client disconnected", append(args, "bytes_sent", sent, "duration", time.Since(c.connected).Round(time.Second))...)
+	}
+
+	// Keep connection alive. With a timeout configured, a client that
+	// neither sends anything nor has data delivered to it within the
+	// window is considered dead.
+	buf := make([]byte, readSize)
+	for {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		_, err := reader.Read(buf)
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			s.mu.RLock()
+			lastWrite := c.lastWrite
+			s.mu.RUnlock()
+			if time.Since(lastWrite) < timeout {
+				continue
+			}
+			disconnected("reason", "idle", "timeout", timeout)
+			return
+		}
+		s.mu.RLock()
+		kicked := c.kicked
+		s.mu.RUnlock()
+		if kicked {
+			disconnected("reason", "disconnected by admin")
+		} else if s.ctx.Err() != nil {
+			disconnected("reason", "server shutting down")
+		} else if s.isDraining() {
+			disconnected("reason", "server draining")
+		} else if err == io.EOF {
+			disconnected("reason", "connection closed by client")
+		} else {
+			disconnected("reason", err)
+		}
+		return
+	}
+}
+
+// DrainTimeout returns the configured grace period for Drain
+func (s *Server) DrainTimeout() time.Duration {
+	return time.Duration(s.settings().Server.DrainTimeout) * time.Second
+}
+
+// Drain stops accepting connections and lets the connected clients go
+// without cutting a frame in half: each mountpoint's clients are
+// disconnected once its stream reaches a frame boundary, chunked v2
+// streams ending with the final empty chunk. Clients still connected
+// after grace are closed. Drain returns once no clients are left; the
+// sources keep running until Stop. Stop during a drain closes everything
+// at once.
+func (s *Server) Drain(grace time.Duration) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		return
+	}
+	s.draining = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	clients := 0
+	for _, m := range s.mounts {
+		// A framer finds the boundaries of unfiltered streams too
+		if m.framer == nil {
+			m.framer = rtcm.NewFramer()
+		}
+		clients += len(m.clients)
+	}
+	s.mu.Unlock()
+	slog.Info("Draining clients", "clients", clients, "grace", grace)
+
+	deadline := time.After(grace)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.clientCount() > 0 {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-deadline:
+			s.mu.Lock()
+			var left []*clientConn
+			for _, m := range s.mounts {
+				for _, c := range m.clients {
+					left = append(left, c)
+				}
+			}
+			s.mu.Unlock()
+			slog.Warn("Drain grace period over, closing remaining clients", "clients", len(left))
+			for _, c := range left {
+				s.removeClient(c)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+	slog.Info("All clients drained")
+}
+
+// endStream finishes a drained client's stream, with the final empty
+// chunk for chunked v2 streams, and closes the connection
+func (s *Server) endStream(c *clientConn) {
+	if c.chunked {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.conn.Write([]byte("0\r\n\r\n"))
+	}
+	c.conn.Close()
+}
+
+// isDraining reports whether Drain has been called
+func (s *Server) isDraining() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.draining
+}
+
+// clientCount returns the number of streaming clients
+func (s *Server) clientCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, m := range s.mounts {
+		n += len(m.clients)
+	}
+	return n
+}
+
+// Stop shuts the server down and waits for all of its goroutines to return
+func (s *Server) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.Wait()
+}
+
+// Wait blocks until the server has shut down, after Stop is called or the
+// context passed to Start is cancelled
+func (s *Server) Wait() {
+	if s.ctx == nil {
+		return
+	}
+	<-s.ctx.Done()
+	s.wg.Wait()
+}
+
+// shutdown closes the listeners, sources and client connections
+func (s *Server) shutdown() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	if s.admin != nil {
+		s.admin.Close()
+	}
+	if s.metrics != nil {
+		s.metrics.Close()
+	}
+	s.mu.Lock()
+	for _, src := range s.sources {
+		if src.conn != nil {
+			src.conn.Close()
+		}
+	}
+	for _, m := range s.mounts {
+		for conn, c := range m.clients {
+			close(c.queue)
+			conn.Close()
+			delete(m.clients, conn)
+		}
+	}
+	s.mu.Unlock()
+}
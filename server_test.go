@@ -0,0 +1,414 @@
+package ntrip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// testCapture writes a capture of RTCM frames to a temporary file and
+// returns its path and contents. The frames are MSM7 observations of a
+// single epoch followed by a station position, so a paced file source
+// sends all of them together after its first delay.
+func testCapture(t *testing.T) (string, []byte) {
+	t.Helper()
+	var data []byte
+	for i := range 20 {
+		payload := make([]byte, 40)
+		payload[0], payload[1] = 1077>>4, (1077&0x0F)<<4
+		payload[20] = byte(i)
+		data = append(data, rtcm.Encode(payload)...)
+	}
+	station := make([]byte, 19)
+	station[0], station[1] = 1005>>4, (1005&0x0F)<<4
+	data = append(data, rtcm.Encode(station)...)
+
+	path := filepath.Join(t.TempDir(), "capture.rtcm")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// startServer runs a caster serving source as mountpoint RTCM3 on an
+// ephemeral loopback port, stopped when the test ends
+func startServer(t *testing.T, source SerialConfig) (*Server, string) {
+	t.Helper()
+	var config Config
+	config.Serial = source
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	return startServerConfig(t, config)
+}
+
+// startServerConfig is startServer with a full configuration
+func startServerConfig(t *testing.T, config Config) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(config)
+	if err := s.Serve(context.Background(), l); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Stop()
+		s.Wait()
+	})
+	return s, l.Addr().String()
+}
+
+// clientCount returns the number of clients subscribed to RTCM3
+func clientCount(s *Server) int {
+	for _, m := range s.Clients() {
+		if m.Name == "RTCM3" {
+			return m.ClientCount
+		}
+	}
+	return 0
+}
+
+// waitFor polls cond until it holds, failing the test after 5 seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestConcurrentClients connects and disconnects many clients while the
+// source is broadcasting, for the race detector to check the locking of
+// the client lists
+func TestConcurrentClients(t *testing.T) {
+	path, _ := testCapture(t)
+	s, addr := startServer(t, SerialConfig{Type: "file", Path: path, Loop: true, Rate: 100})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		// Read the stats while clients come and go
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.Stats()
+			}
+		}
+	}()
+	defer close(done)
+
+	const clients = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewClient(addr, "RTCM3", "", "", "")
+			if i%2 == 1 {
+				c.Version = NtripV2
+			}
+			stream, err := c.Stream(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer stream.Close()
+			buf := make([]byte, 2048)
+			if _, err := io.ReadAtLeast(stream, buf, len(buf)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("client: %v", err)
+	}
+	waitFor(t, "clients to be removed", func() bool { return clientCount(s) == 0 })
+}
+
+// TestStopLeavesNoGoroutines stops a server with clients streaming and
+// checks that every goroutine it started has returned
+func TestStopLeavesNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	path, _ := testCapture(t)
+	var config Config
+	config.Serial = SerialConfig{Type: "file", Path: path, Loop: true, Rate: 50}
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	config.Admin.Addr = "127.0.0.1:0"
+	s, addr := startServerConfig(t, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var streams []io.ReadCloser
+	for _, version := range []int{NtripV1, NtripV2} {
+		c := NewClient(addr, "RTCM3", "", "", "")
+		c.Version = version
+		stream, err := c.Stream(ctx)
+		if err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		streams = append(streams, stream)
+		if _, err := io.ReadFull(stream, make([]byte, 64)); err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+	}
+
+	s.Stop()
+	for _, stream := range streams {
+		// The server closed the connection, the stream ends
+		if _, err := io.Copy(io.Discard, stream); err != nil {
+			t.Logf("stream after Stop: %v", err)
+		}
+		stream.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines running after Stop, %d before Start:\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dialMount opens a raw connection to the RTCM3 mountpoint, sending the
+// request of an NTRIP client of the given version
+func dialMount(t *testing.T, addr string, version int) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c := NewClient(addr, "RTCM3", "", "", "")
+	if _, err := conn.Write([]byte(c.buildRequest("RTCM3", version))); err != nil {
+		t.Fatal(err)
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		chunked bool
+		proto   string
+	}{
+		{name: "v1", version: NtripV1, proto: "ICY"},
+		{name: "v1 with chunked set", version: NtripV1, chunked: true, proto: "ICY"},
+		{name: "v2", version: NtripV2, proto: "HTTP/1.1"},
+		{name: "v2 chunked", version: NtripV2, chunked: true, proto: "HTTP/1.1"},
+	}
+	path, _ := testCapture(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Serial = SerialConfig{Type: "file", Path: path, Loop: true, Rate: 100}
+			config.Server.Chunked = tt.chunked
+			config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+			_, addr := startServerConfig(t, config)
+
+			_, r := dialMount(t, addr, tt.version)
+			resp, err := parseResponse(r)
+			if err != nil {
+				t.Fatalf("parseResponse: %v", err)
+			}
+			if resp.proto != tt.proto || resp.status != 200 {
+				t.Errorf("status %s %d, want %s 200", resp.proto, resp.status, tt.proto)
+			}
+			if resp.chunked != (tt.chunked && tt.version == NtripV2) {
+				t.Errorf("chunked = %v", resp.chunked)
+			}
+			if tt.version == NtripV2 && resp.header["content-type"] != "gnss/data" {
+				t.Errorf("Content-Type = %q, want gnss/data", resp.header["content-type"])
+			}
+
+			var body io.Reader = r
+			if resp.chunked {
+				body = httputil.NewChunkedReader(r)
+			}
+			if msgs := rtcm.NewFramer().Feed(readAtLeast(t, body, 256)); len(msgs) == 0 {
+				t.Error("no RTCM frames after the response headers")
+			}
+		})
+	}
+}
+
+// readAtLeast reads n bytes or more from r
+func readAtLeast(t *testing.T, r io.Reader, n int) []byte {
+	t.Helper()
+	buf := make([]byte, 2*n)
+	got, err := io.ReadAtLeast(r, buf, n)
+	if err != nil {
+		t.Fatalf("read %d bytes: %v", got, err)
+	}
+	return buf[:got]
+}
+
+// TestClientsReceiveSource connects v1 and v2 clients before the source
+// sends anything and checks each receives exactly the bytes of the file
+func TestClientsReceiveSource(t *testing.T) {
+	path, data := testCapture(t)
+	var config Config
+	// A single paced epoch, sent once the clients are connected
+	config.Serial = SerialConfig{Type: "file", Path: path, Rate: 1}
+	config.Server.Chunked = true
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	s, addr := startServerConfig(t, config)
+
+	// A v1 client looks past the ICY status line for headers, so its
+	// handshake only completes once data arrives: connect them all at once
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const clients = 6
+	streams := make([]io.ReadCloser, clients)
+	errs := make([]error, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewClient(addr, "RTCM3", "", "", "")
+			c.Version = []int{NtripV1, NtripV2}[i%2]
+			streams[i], errs[i] = c.Stream(ctx)
+		}()
+	}
+	waitFor(t, "clients to connect", func() bool { return clientCount(s) == clients })
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("client %d: Stream: %v", i, err)
+		}
+		defer streams[i].Close()
+	}
+
+	for i, stream := range streams {
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(stream, got); err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("client %d received bytes differing from the source", i)
+		}
+	}
+}
+
+// TestClientDisconnect closes one of two clients and checks the server
+// removes it, and only it, from the mountpoint
+func TestClientDisconnect(t *testing.T) {
+	path, _ := testCapture(t)
+	s, addr := startServer(t, SerialConfig{Type: "file", Path: path, Loop: true, Rate: 100})
+
+	leaving, _ := dialMount(t, addr, NtripV1)
+	staying, r := dialMount(t, addr, NtripV2)
+	if _, err := parseResponse(r); err != nil {
+		t.Fatalf("parseResponse: %v", err)
+	}
+	waitFor(t, "clients to connect", func() bool { return clientCount(s) == 2 })
+
+	leaving.Close()
+	waitFor(t, "the client to be removed", func() bool { return clientCount(s) == 1 })
+	for _, m := range s.Clients() {
+		for _, c := range m.Clients {
+			if c.RemoteAddr != staying.LocalAddr().String() {
+				t.Errorf("client %s left on %s, want %s", c.RemoteAddr, m.Name, staying.LocalAddr())
+			}
+		}
+	}
+	readAtLeast(t, r, 256)
+}
+
+// throttledConn accepts at most limit bytes per write, as a congested
+// connection might
+type throttledConn struct {
+	net.Conn
+	limit  int
+	writes int
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Conn.Write(p[:min(len(p), c.limit)])
+}
+
+func TestWriteAllShortWrites(t *testing.T) {
+	_, data := testCapture(t)
+	server, client := net.Pipe()
+	defer client.Close()
+	received := make(chan []byte)
+	go func() {
+		got, _ := io.ReadAll(client)
+		received <- got
+	}()
+
+	conn := &throttledConn{Conn: server, limit: 7}
+	n, err := writeAll(conn, data)
+	server.Close()
+	if n != len(data) || err != nil {
+		t.Fatalf("writeAll = %d, %v, want %d, nil", n, err, len(data))
+	}
+	if want := (len(data) + 6) / 7; conn.writes != want {
+		t.Errorf("%d writes, want %d of at most 7 bytes", conn.writes, want)
+	}
+	if got := <-received; !bytes.Equal(got, data) {
+		t.Error("data received differs from the data written")
+	}
+}
+
+// TestClientNeverReading connects a client that never reads under the
+// drop policy and checks it is disconnected once its writes stall, while
+// another client keeps receiving the stream
+func TestClientNeverReading(t *testing.T) {
+	path, _ := testCapture(t)
+	var config Config
+	config.Serial = SerialConfig{Type: "file", Path: path, Loop: true, Rate: 100}
+	config.Server.SlowClientPolicy = policyDrop
+	config.Server.WriteTimeout = 1
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	s, addr := startServerConfig(t, config)
+
+	stuck, _ := dialMount(t, addr, NtripV1)
+	stuck.(*net.TCPConn).SetReadBuffer(4096)
+	stuck.SetDeadline(time.Time{})
+	reading, r := dialMount(t, addr, NtripV1)
+	waitFor(t, "clients to connect", func() bool { return clientCount(s) == 2 })
+
+	deadline := time.Now().Add((maxWriteStalls + 5) * time.Second)
+	for clientCount(s) == 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("client that never reads still connected")
+		}
+		reading.SetReadDeadline(time.Now().Add(5 * time.Second))
+		readAtLeast(t, r, 4096)
+	}
+	for _, m := range s.Clients() {
+		for _, c := range m.Clients {
+			if c.RemoteAddr != reading.LocalAddr().String() {
+				t.Errorf("client %s left connected, want only %s", c.RemoteAddr, reading.LocalAddr())
+			}
+		}
+	}
+	reading.SetReadDeadline(time.Now().Add(5 * time.Second))
+	readAtLeast(t, r, 4096)
+}
@@ -0,0 +1,179 @@
+package ntrip
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+const (
+	// defaultSidecarInterval is how often the sidecar is rewritten during
+	// a capture when SidecarInterval is not set
+	defaultSidecarInterval = time.Minute
+	// maxSidecarGaps bounds the epoch gaps listed in the sidecar, the
+	// totals keep counting past it
+	maxSidecarGaps = 1000
+)
+
+// CaptureInfo is the metadata of a capture written as JSON next to its
+// first output file, see Client.Sidecar
+type CaptureInfo struct {
+	Caster     string    `json:"caster"`
+	Mountpoint string    `json:"mountpoint"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	// Complete is set once the client has stopped and closed the files.
+	// A sidecar left incomplete describes a capture cut short by a crash,
+	// up to its last periodic update.
+	Complete    bool               `json:"complete"`
+	Bytes       int64              `json:"bytes"`
+	Timestamped bool               `json:"timestamped"`
+	Files       []string           `json:"files"`
+	Messages    map[int]int        `json:"messages"`
+	Connections []CaptureConn      `json:"connections"`
+	Continuity  *CaptureContinuity `json:"continuity,omitempty"`
+	Gaps        []CaptureGap       `json:"gaps,omitempty"`
+}
+
+// CaptureContinuity totals the epoch gaps found with CheckContinuity
+type CaptureContinuity struct {
+	Gaps    int     `json:"gaps"`
+	Missed  int     `json:"missed_epochs"`
+	Longest float64 `json:"longest_gap_seconds"`
+}
+
+// CaptureConn is one connection to a caster during a capture
+type CaptureConn struct {
+	Caster       string    `json:"caster"`
+	Mountpoint   string    `json:"mountpoint"`
+	Connected    time.Time `json:"connected"`
+	Disconnected time.Time `json:"disconnected,omitzero"`
+}
+
+// CaptureGap is a gap in the epochs of a message type, found with
+// CheckContinuity
+type CaptureGap struct {
+	Time     time.Time `json:"time"`
+	Message  int       `json:"message"`
+	Seconds  float64   `json:"seconds"`
+	Expected float64   `json:"expected_seconds"`
+}
+
+// noteConnected records the start of a connection for the sidecar
+func (c *Client) noteConnected() {
+	if !c.Sidecar {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.capture.Start.IsZero() {
+		c.capture.Caster, c.capture.Mountpoint, c.capture.Start = c.ServerAddr, c.Mountpoint, now
+	}
+	c.capture.Connections = append(c.capture.Connections, CaptureConn{Caster: c.ServerAddr, Mountpoint: c.Mountpoint, Connected: now})
+}
+
+// noteDisconnected records the end of the current connection
+func (c *Client) noteDisconnected() {
+	if !c.Sidecar {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.capture.Connections); n > 0 {
+		c.capture.Connections[n-1].Disconnected = time.Now()
+	}
+}
+
+// noteGaps records epoch gaps for the sidecar. The caller holds c.mu.
+func (c *Client) noteGaps(gaps []rtcm.Gap, at time.Time) {
+	for _, gap := range gaps {
+		if !c.Sidecar || len(c.capture.Gaps) >= maxSidecarGaps {
+			return
+		}
+		c.capture.Gaps = append(c.capture.Gaps, CaptureGap{Time: at, Message: gap.Message,
+			Seconds: gap.Duration.Seconds(), Expected: gap.Expected.Seconds()})
+	}
+}
+
+// updateSidecar rewrites the sidecar once SidecarInterval has passed since
+// the last write, so a crash loses at most that much of the metadata
+func (c *Client) updateSidecar() {
+	interval := c.SidecarInterval
+	if interval <= 0 {
+		interval = defaultSidecarInterval
+	}
+	if c.Sidecar && time.Since(c.sidecarWritten) >= interval {
+		c.writeSidecar(false)
+	}
+}
+
+// finishSidecar writes the final sidecar once the client stops
+func (c *Client) finishSidecar() {
+	if c.Sidecar {
+		c.writeSidecar(true)
+	}
+}
+
+// writeSidecar writes <first output>.json, replacing the previous version
+// atomically. Nothing is written before the first output file is opened.
+func (c *Client) writeSidecar(complete bool) {
+	if len(c.outputs) == 0 {
+		return
+	}
+	c.sidecarWritten = time.Now()
+	c.mu.Lock()
+	info := c.capture
+	info.End, info.Complete = c.sidecarWritten, complete
+	info.Bytes = c.received
+	info.Timestamped = c.Timestamped
+	info.Messages = maps.Clone(c.counts)
+	info.Connections = append([]CaptureConn(nil), c.capture.Connections...)
+	info.Gaps = append([]CaptureGap(nil), c.capture.Gaps...)
+	if c.continuity != nil {
+		stats := c.continuity.GapStats
+		info.Continuity = &CaptureContinuity{Gaps: stats.Gaps, Missed: stats.Missed, Longest: stats.Longest.Seconds()}
+	}
+	c.mu.Unlock()
+	if info.Messages == nil {
+		info.Messages = map[int]int{}
+	}
+	last := len(c.outputs) - 1
+	for i, o := range c.outputs {
+		switch {
+		case o.pruned:
+		case c.Compress && i < last:
+			info.Files = append(info.Files, o.name+".gz")
+		default:
+			info.Files = append(info.Files, o.name)
+		}
+	}
+
+	name := c.outputs[0].name + ".json"
+	if err := writeJSONFile(name, info); err != nil {
+		slog.Warn("Failed to write capture sidecar", "file", name, "err", err)
+	}
+}
+
+// writeJSONFile writes v as indented JSON to name through a temporary
+// file, so readers never see a partial file
+func writeJSONFile(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %v", name, err)
+	}
+	return nil
+}
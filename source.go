@@ -0,0 +1,449 @@
+package ntrip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// Source types selecting where a source reads its feed from
+const (
+	sourceSerial = "serial"
+	sourceTCP    = "tcp"
+	sourceNTRIP  = "ntrip"
+	sourceFile   = "file"
+)
+
+// dialTimeout bounds connecting to a TCP source
+const dialTimeout = 10 * time.Second
+
+// source is a feed broadcast to every mountpoint that refers to it
+type source struct {
+	name       string
+	config     SerialConfig
+	conn       io.ReadCloser
+	buffer     *ring
+	mounts     []*mountpoint
+	running    bool // A reader goroutine was started for the source
+	open       bool // The source is connected, false while reconnecting
+	bytesRead  int64
+	reconnects int
+	lastRead   time.Time // When data last arrived
+	silent     bool      // No data within the data timeout
+	framer     *rtcm.Framer
+	messages   map[int]int64 // RTCM frames read per message type
+	// position is the base station latitude and longitude from the last
+	// 1005/1006 message, valid once located is set
+	position [2]float64
+	located  bool
+	// Repeated read and reconnect errors are logged rate-limited
+	readErrors      repeatLog
+	reconnectErrors repeatLog
+	// wake is signalled when clients of an on-demand source come or go,
+	// demanded is set while it is connected for them
+	wake     chan struct{}
+	demanded bool
+	// With SplitNMEA only RTCM frames are broadcast and the NMEA
+	// sentences between them are collected here during framing
+	nmea      nmeaSplitter
+	sentences []string
+	gga       *GGAPosition // Last GGA position with a fix
+}
+
+func newSource(name string, config SerialConfig) *source {
+	if config.Type == "" {
+		config.Type = sourceSerial
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = defaultReconnectInterval
+	}
+	if config.MaxReconnectInterval < config.ReconnectInterval {
+		config.MaxReconnectInterval = defaultMaxReconnectInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultSourceBufferSize
+	}
+	if config.ReadBufferSize <= 0 {
+		config.ReadBufferSize = defaultReadBufferSize
+	}
+	src := &source{
+		name:     name,
+		config:   config,
+		buffer:   newRing(config.BufferSize),
+		framer:   rtcm.NewFramer(),
+		messages: make(map[int]int64),
+		wake:     make(chan struct{}, 1),
+	}
+	if config.SplitNMEA {
+		src.framer.OnSkip = func(data []byte) {
+			src.sentences = append(src.sentences, src.nmea.feed(data)...)
+		}
+	}
+	return src
+}
+
+// locate records the station position of a 1005/1006 message. The caller
+// holds s.mu.
+func (src *source) locate(msg rtcm.Message) {
+	arp, err := rtcm.ParseStationARP(msg.Payload)
+	if err != nil {
+		return
+	}
+	lat, lon, _ := arp.Geodetic()
+	src.position, src.located = [2]float64{lat, lon}, true
+}
+
+// openSource connects a source to its serial port, TCP stream, upstream
+// caster or file. An upstream connection is closed once ctx is done.
+func (s *Server) openSource(ctx context.Context, src *source) error {
+	var conn io.ReadCloser
+	var err error
+	switch src.config.Type {
+	case sourceSerial:
+		conn, err = openSerial(src)
+	case sourceTCP:
+		conn, err = openTCP(src)
+	case sourceNTRIP:
+		conn, err = openUpstream(ctx, src)
+	case sourceFile:
+		conn, err = openFile(src)
+	default:
+		err = fmt.Errorf("invalid type %q for source %s", src.config.Type, src.name)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	src.conn = conn
+	src.open = true
+	s.mu.Unlock()
+	return nil
+}
+
+// openTCP dials a receiver streaming raw RTCM over TCP
+func openTCP(src *source) (io.ReadCloser, error) {
+	if src.config.Address == "" {
+		return nil, fmt.Errorf("no address configured for tcp source %s", src.name)
+	}
+	conn, err := net.DialTimeout("tcp", src.config.Address, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", src.config.Address, err)
+	}
+	slog.Info("Connected to TCP source", "source", src.name, "addr", src.config.Address)
+	return conn, nil
+}
+
+// openUpstream connects to another caster as a client, relaying its
+// mountpoint without storing anything to disk
+func openUpstream(ctx context.Context, src *source) (io.ReadCloser, error) {
+	up := src.config.Upstream
+	if up.ServerAddr == "" || up.Mountpoint == "" {
+		return nil, fmt.Errorf("no upstream server_addr and mountpoint configured for ntrip source %s", src.name)
+	}
+	c := NewClient(up.ServerAddr, up.Mountpoint, up.Username, up.Password, "")
+	if up.Version == NtripV2 {
+		c.Version = NtripV2
+	}
+	body, err := c.open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to upstream %s/%s: %v", up.ServerAddr, up.Mountpoint, err)
+	}
+	slog.Info("Relaying upstream caster", "source", src.name, "server", up.ServerAddr, "mountpoint", up.Mountpoint)
+	return body, nil
+}
+
+// readSource reads the source into its buffer as fast as it delivers,
+// leaving the fan-out to clients to drainSource
+func (s *Server) readSource(src *source) {
+	s.spawn(func() { s.drainSource(src) })
+	defer src.buffer.Close()
+	if src.config.DataTimeout > 0 {
+		s.spawn(func() { s.watchSource(src) })
+	}
+
+	if src.config.OnDemand {
+		s.demandSource(src)
+		return
+	}
+	s.pump(s.ctx, src)
+}
+
+// pump copies the open source into its buffer, reconnecting on errors,
+// until ctx is done
+func (s *Server) pump(ctx context.Context, src *source) {
+	s.mu.Lock()
+	src.lastRead = time.Now()
+	s.mu.Unlock()
+
+	buf := make([]byte, src.config.ReadBufferSize)
+	for {
+		n, err := src.conn.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			src.bytesRead += int64(n)
+			src.lastRead = time.Now()
+			resumed := src.silent
+			src.silent = false
+			s.mu.Unlock()
+			if resumed {
+				slog.Info("Source data resumed", "source", src.name)
+			}
+			src.readErrors.reset()
+			src.buffer.Write(buf[:n])
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			// The device or upstream is most likely gone, reopen it
+			// rather than spinning on a dead handle
+			src.readErrors.log(slog.LevelError, "Error reading from source", err, "source", src.name)
+			s.mu.Lock()
+			src.open = false
+			s.mu.Unlock()
+			src.conn.Close()
+			if !s.reconnectSource(ctx, src) {
+				return
+			}
+		}
+	}
+}
+
+// demandSource connects an on-demand source only while any of its
+// mountpoints has clients, disconnecting it when the last one leaves
+func (s *Server) demandSource(src *source) {
+	for {
+		for !s.wanted(src) {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-src.wake:
+			}
+		}
+
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.spawn(func() { s.idleSource(ctx, cancel, src) })
+		s.mu.Lock()
+		src.demanded = true
+		s.mu.Unlock()
+		slog.Info("Client connected, opening on-demand source", "source", src.name)
+		if err := s.openSource(ctx, src); err != nil {
+			slog.Warn("Failed to open on-demand source", "source", src.name, "err", err)
+			if s.reconnectSource(ctx, src) {
+				s.pump(ctx, src)
+			}
+		} else if s.stillWanted(ctx, src) {
+			s.pump(ctx, src)
+		}
+		cancel()
+
+		s.mu.Lock()
+		src.demanded = false
+		src.open = false
+		if src.conn != nil {
+			src.conn.Close()
+			src.conn = nil
+		}
+		s.mu.Unlock()
+		if s.ctx.Err() != nil {
+			return
+		}
+		// A client arriving while the connection was torn down finds
+		// wanted true on the next pass and reconnects straight away
+		slog.Info("Closed on-demand source, no clients left", "source", src.name)
+	}
+}
+
+// idleSource cancels ctx, closing the connection of an on-demand source,
+// once none of its mountpoints has clients left
+func (s *Server) idleSource(ctx context.Context, cancel context.CancelFunc, src *source) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-src.wake:
+		}
+		if s.wanted(src) {
+			continue
+		}
+		slog.Info("Last client left, disconnecting on-demand source", "source", src.name)
+		cancel()
+		s.mu.Lock()
+		if src.conn != nil {
+			src.conn.Close()
+		}
+		s.mu.Unlock()
+		return
+	}
+}
+
+// stillWanted reports whether ctx is still live after opening a source,
+// closing the connection when the clients left while it was being opened
+func (s *Server) stillWanted(ctx context.Context, src *source) bool {
+	if ctx.Err() == nil {
+		return true
+	}
+	s.mu.Lock()
+	src.conn.Close()
+	s.mu.Unlock()
+	return false
+}
+
+// wanted reports whether any mountpoint of the source has clients
+func (s *Server) wanted(src *source) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range src.mounts {
+		if len(m.clients) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyDemand wakes the on-demand sources feeding m after its clients
+// changed. The caller holds s.mu.
+func (s *Server) notifyDemand(m *mountpoint) {
+	for _, src := range s.sources {
+		if !src.config.OnDemand || !slices.Contains(src.mounts, m) {
+			continue
+		}
+		select {
+		case src.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchSource flags the source as silent once no data has arrived for its
+// data timeout, and optionally disconnects the clients of its mountpoints
+func (s *Server) watchSource(src *source) {
+	timeout := time.Duration(src.config.DataTimeout) * time.Second
+	ticker := time.NewTicker(min(timeout, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if src.config.OnDemand && !src.demanded {
+			// Nothing is expected from a source nobody asked for
+			src.lastRead = time.Now()
+			src.silent = false
+		}
+		idle := time.Since(src.lastRead)
+		silenced := idle >= timeout && !src.silent
+		if silenced {
+			src.silent = true
+		}
+		var clients []*clientConn
+		if silenced && src.config.DisconnectOnSilence {
+			for _, m := range src.mounts {
+				for _, c := range m.clients {
+					clients = append(clients, c)
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		if !silenced {
+			continue
+		}
+		slog.Warn("Source stopped sending data", "source", src.name, "idle", idle.Round(time.Second))
+		for _, c := range clients {
+			c.log.Info("Disconnecting client of silent source", "source", src.name)
+			s.removeClient(c)
+		}
+	}
+}
+
+// drainSource forwards buffered source data to all clients of the
+// source's mountpoints until the reader stops, counting its RTCM messages
+// on the way. With SplitNMEA only the RTCM frames are forwarded and the
+// NMEA sentences go to handleNMEA.
+func (s *Server) drainSource(src *source) {
+	nmeaLog := s.openNMEALog(src)
+	if nmeaLog != nil {
+		defer nmeaLog.Close()
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n := src.buffer.Read(buf)
+		if n == 0 {
+			return
+		}
+		data := buf[:n]
+		msgs := src.framer.Feed(data)
+		if src.config.SplitNMEA {
+			data = data[:0:0]
+			for _, msg := range msgs {
+				data = append(data, msg.Frame...)
+			}
+			s.handleNMEA(src, nmeaLog)
+		}
+		s.mu.Lock()
+		for _, msg := range msgs {
+			src.messages[msg.Number]++
+			if msg.Number == 1005 || msg.Number == 1006 {
+				src.locate(msg)
+			}
+		}
+		mounts := src.mounts
+		s.mu.Unlock()
+		if len(data) == 0 {
+			continue
+		}
+		for _, m := range mounts {
+			s.broadcast(m, data)
+		}
+	}
+}
+
+// reconnectSource re-opens a source with exponential backoff. It returns
+// false if ctx is done before the source comes back.
+func (s *Server) reconnectSource(ctx context.Context, src *source) bool {
+	interval := time.Duration(src.config.ReconnectInterval) * time.Second
+	maxInterval := time.Duration(src.config.MaxReconnectInterval) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+
+		slog.Info("Reconnecting source", "source", src.name, "attempt", attempt)
+		s.mu.Lock()
+		src.reconnects++
+		s.mu.Unlock()
+		if err := s.openSource(ctx, src); err != nil {
+			src.reconnectErrors.log(slog.LevelWarn, "Source reconnect failed", err, "source", src.name, "attempt", attempt)
+			interval *= 2
+			if interval > maxInterval {
+				interval = maxInterval
+			}
+			continue
+		}
+
+		src.reconnectErrors.reset()
+		if !s.stillWanted(ctx, src) {
+			return false
+		}
+		slog.Info("Source reconnected", "source", src.name, "attempts", attempt)
+		return true
+	}
+}
@@ -0,0 +1,236 @@
+package ntrip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StreamInfo describes a mountpoint as advertised in the STR record of the
+// sourcetable
+type StreamInfo struct {
+	Mountpoint     string  `yaml:"mountpoint"`
+	Identifier     string  `yaml:"identifier"`
+	Format         string  `yaml:"format"`
+	FormatDetails  string  `yaml:"format_details"`
+	Carrier        int     `yaml:"carrier"`
+	NavSystem      string  `yaml:"nav_system"`
+	Network        string  `yaml:"network"`
+	Country        string  `yaml:"country"`
+	Latitude       float64 `yaml:"latitude"`
+	Longitude      float64 `yaml:"longitude"`
+	NMEA           bool    `yaml:"nmea"`
+	Solution       int     `yaml:"solution"`
+	Generator      string  `yaml:"generator"`
+	Compression    string  `yaml:"compression"`
+	Authentication string  `yaml:"authentication"`
+	Fee            bool    `yaml:"fee"`
+	Bitrate        int     `yaml:"bitrate"`
+	Misc           string  `yaml:"misc"`
+}
+
+// strRecord formats the stream as a sourcetable STR line
+func (si StreamInfo) strRecord() string {
+	auth := si.Authentication
+	if auth == "" {
+		auth = "N"
+	}
+	fee := "N"
+	if si.Fee {
+		fee = "Y"
+	}
+	nmea := 0
+	if si.NMEA {
+		nmea = 1
+	}
+	return fmt.Sprintf("STR;%s;%s;%s;%s;%d;%s;%s;%s;%.2f;%.2f;%d;%d;%s;%s;%s;%s;%d;%s",
+		si.Mountpoint, si.Identifier, si.Format, si.FormatDetails, si.Carrier,
+		si.NavSystem, si.Network, si.Country, si.Latitude, si.Longitude, nmea,
+		si.Solution, si.Generator, si.Compression, auth, fee, si.Bitrate, si.Misc)
+}
+
+// CasterInfo is a CAS record of a sourcetable
+type CasterInfo struct {
+	Host         string
+	Port         int
+	Identifier   string
+	Operator     string
+	NMEA         bool
+	Country      string
+	Latitude     float64
+	Longitude    float64
+	FallbackHost string
+	FallbackPort int
+	Misc         string
+}
+
+// NetworkInfo is a NET record of a sourcetable
+type NetworkInfo struct {
+	Identifier     string
+	Operator       string
+	Authentication string
+	Fee            bool
+	WebNet         string
+	WebStr         string
+	WebReg         string
+	Misc           string
+}
+
+// SourceTable is a caster's sourcetable as returned to a request for /
+type SourceTable struct {
+	Streams  []StreamInfo
+	Casters  []CasterInfo
+	Networks []NetworkInfo
+}
+
+// ParseSourceTable reads STR, CAS and NET records up to ENDSOURCETABLE or
+// the end of r. Unknown and short records are skipped.
+func ParseSourceTable(r io.Reader) (*SourceTable, error) {
+	table := &SourceTable{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "ENDSOURCETABLE" {
+			return table, nil
+		}
+		table.add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return table, fmt.Errorf("failed to read sourcetable: %v", err)
+	}
+	return table, nil
+}
+
+// add parses an STR, CAS or NET record into the table, reporting whether
+// line was one
+func (t *SourceTable) add(line string) bool {
+	f := strings.Split(line, ";")
+	switch {
+	case f[0] == "STR" && len(f) >= 19:
+		t.Streams = append(t.Streams, parseSTR(f))
+	case f[0] == "CAS" && len(f) >= 12:
+		t.Casters = append(t.Casters, CasterInfo{
+			Host: f[1], Port: atoi(f[2]), Identifier: f[3], Operator: f[4],
+			NMEA: f[5] == "1", Country: f[6], Latitude: atof(f[7]), Longitude: atof(f[8]),
+			FallbackHost: f[9], FallbackPort: atoi(f[10]), Misc: strings.Join(f[11:], ";"),
+		})
+	case f[0] == "NET" && len(f) >= 9:
+		t.Networks = append(t.Networks, NetworkInfo{
+			Identifier: f[1], Operator: f[2], Authentication: f[3], Fee: f[4] == "Y",
+			WebNet: f[5], WebStr: f[6], WebReg: f[7], Misc: strings.Join(f[8:], ";"),
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// isRecord reports whether line starts like a sourcetable record
+func isRecord(line string) bool {
+	return strings.HasPrefix(line, "STR;") || strings.HasPrefix(line, "CAS;") || strings.HasPrefix(line, "NET;")
+}
+
+// parseSTR converts the fields of an STR record back into a StreamInfo
+func parseSTR(f []string) StreamInfo {
+	return StreamInfo{
+		Mountpoint: f[1], Identifier: f[2], Format: f[3], FormatDetails: f[4],
+		Carrier: atoi(f[5]), NavSystem: f[6], Network: f[7], Country: f[8],
+		Latitude: atof(f[9]), Longitude: atof(f[10]), NMEA: f[11] == "1",
+		Solution: atoi(f[12]), Generator: f[13], Compression: f[14],
+		Authentication: f[15], Fee: f[16] == "Y", Bitrate: atoi(f[17]),
+		Misc: strings.Join(f[18:], ";"),
+	}
+}
+
+// atoi and atof parse sourcetable numbers, treating malformed ones as zero
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func atof(s string) float64 {
+	x, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return x
+}
+
+// liveInfo is what the sourcetable advertises of a stream from its data
+type liveInfo struct {
+	bitrate  int
+	position [2]float64
+	located  bool
+}
+
+// apply replaces the configured bitrate and position of si with the
+// measured ones, keeping the configuration until data has been seen
+func (li liveInfo) apply(si StreamInfo) StreamInfo {
+	if li.bitrate > 0 {
+		si.Bitrate = li.bitrate
+	}
+	if li.located {
+		si.Latitude, si.Longitude = li.position[0], li.position[1]
+	}
+	return si
+}
+
+// sourceTable builds the SOURCETABLE response listing every configured
+// mountpoint. The bitrate is the measured one and the position that of
+// the last 1005/1006 message of the mountpoint's source, the configured
+// values standing in before any data has arrived.
+func (s *Server) sourceTable(version int) string {
+	config := s.settings()
+	s.mu.RLock()
+	live := make(map[string]liveInfo, len(s.mounts))
+	for name, m := range s.mounts {
+		live[name] = liveInfo{bitrate: m.bitrate()}
+	}
+	for _, src := range s.sources {
+		if !src.located {
+			continue
+		}
+		for _, m := range src.mounts {
+			li := live[m.name]
+			li.position, li.located = src.position, true
+			live[m.name] = li
+		}
+	}
+	s.mu.RUnlock()
+
+	var body strings.Builder
+	listed := make(map[string]bool)
+	for _, si := range config.SourceTable {
+		si = live[si.Mountpoint].apply(si)
+		body.WriteString(si.strRecord())
+		body.WriteString("\r\n")
+		listed[si.Mountpoint] = true
+	}
+	// Mountpoints without metadata still get a minimal entry
+	for _, mc := range config.Mountpoints {
+		if !mc.enabled() || listed[mc.Name] {
+			continue
+		}
+		si := live[mc.Name].apply(StreamInfo{Mountpoint: mc.Name, Identifier: mc.Description, Format: "RTCM 3"})
+		if len(config.Server.Users) > 0 {
+			si.Authentication = "B"
+		}
+		body.WriteString(si.strRecord())
+		body.WriteString("\r\n")
+	}
+	body.WriteString("ENDSOURCETABLE\r\n")
+
+	length := fmt.Sprintf("Content-Length: %d", body.Len())
+	if version == NtripV2 {
+		return statusResponse(s.serverHeader(), NtripV2, http.StatusOK, "Content-Type: gnss/sourcetable", length) + body.String()
+	}
+
+	var resp strings.Builder
+	resp.WriteString("SOURCETABLE 200 OK\r\n")
+	resp.WriteString("Server: " + s.serverHeader() + "\r\n")
+	resp.WriteString("Content-Type: text/plain\r\n")
+	resp.WriteString(length + "\r\n")
+	resp.WriteString("\r\n")
+	resp.WriteString(body.String())
+	return resp.String()
+}
@@ -0,0 +1,232 @@
+package ntrip
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ntrip/rtcm"
+)
+
+// MessageGroup names a set of RTCM message types split into one file
+type MessageGroup struct {
+	Name  string
+	Types []int
+}
+
+// StandardGroup returns the group of message types known by name: msm,
+// legacy (the 1001-1004 and 1009-1012 observations), ephemeris or station
+// (position, antenna and receiver descriptors)
+func StandardGroup(name string) (MessageGroup, bool) {
+	var types []int
+	switch name {
+	case "msm":
+		for n := 1071; n <= 1137; n++ {
+			if rtcm.IsMSM(n) {
+				types = append(types, n)
+			}
+		}
+	case "legacy":
+		types = []int{1001, 1002, 1003, 1004, 1009, 1010, 1011, 1012}
+	case "ephemeris":
+		types = []int{1019, 1020, 1041, 1042, 1044, 1045, 1046}
+	case "station":
+		types = []int{1005, 1006, 1007, 1008, 1033}
+	default:
+		return MessageGroup{}, false
+	}
+	return MessageGroup{Name: name, Types: types}, true
+}
+
+// SplitOptions configures SplitCapture
+type SplitOptions struct {
+	// Prefix starts the name of every file written, followed by
+	// _<group>.bin. By default it is the capture's name without its
+	// extension.
+	Prefix string
+	// Groups collects message types into shared files. Other types get a
+	// file of their own, named by type number, unless GroupsOnly is set
+	// to drop them.
+	Groups     []MessageGroup
+	GroupsOnly bool
+	// Timestamped reads a capture written with Client.Timestamped and
+	// writes the files as records, each frame keeping the arrival time of
+	// the chunk completing it
+	Timestamped bool
+}
+
+// SplitFile is a file written by SplitCapture
+type SplitFile struct {
+	Name   string
+	Frames int64
+	Bytes  int64
+}
+
+// SplitResult reports what SplitCapture read and wrote
+type SplitResult struct {
+	Files []SplitFile // Ordered by name
+	// Counts is the number of frames of each message type read
+	Counts map[int]int64
+	// Dropped counts frames of types in no group with GroupsOnly
+	Dropped int64
+	// Discarded and CRCErrors are the bytes skipped outside valid frames
+	// and the candidate frames failing the CRC check. Truncated is the
+	// length of an incomplete frame at the end of the capture, which is
+	// not written.
+	Discarded int64
+	CRCErrors int64
+	Truncated int
+}
+
+// splitOutput is a file being written by SplitCapture
+type splitOutput struct {
+	file    *os.File
+	w       *bufio.Writer
+	pending []byte // Frames of the current chunk
+	SplitFile
+}
+
+// SplitCapture reads the capture at path, raw or gzipped as rotation
+// leaves it, through the RTCM framer and writes its valid frames to a
+// separate file per message type or group. Frames are written whole and
+// in their original order, so each file is itself a valid RTCM stream.
+// Files are only created for types that occur and are overwritten if they
+// exist.
+func SplitCapture(path string, opts SplitOptions) (SplitResult, error) {
+	result := SplitResult{Counts: make(map[int]int64)}
+	in, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	base := path
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		defer zr.Close()
+		r = zr
+		base = strings.TrimSuffix(path, ".gz")
+	}
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	groupOf := make(map[int]string)
+	for _, g := range opts.Groups {
+		for _, n := range g.Types {
+			if _, ok := groupOf[n]; !ok {
+				groupOf[n] = g.Name
+			}
+		}
+	}
+
+	outputs := make(map[string]*splitOutput)
+	framer := rtcm.NewFramer()
+	// split writes the frames completed by a chunk arriving at t
+	split := func(data []byte, t time.Time) error {
+		var touched []*splitOutput
+		for _, msg := range framer.Feed(data) {
+			result.Counts[msg.Number]++
+			name, ok := groupOf[msg.Number]
+			if !ok {
+				if opts.GroupsOnly {
+					result.Dropped++
+					continue
+				}
+				name = strconv.Itoa(msg.Number)
+			}
+			out := outputs[name]
+			if out == nil {
+				f, err := os.Create(prefix + "_" + name + ".bin")
+				if err != nil {
+					return err
+				}
+				out = &splitOutput{file: f, w: bufio.NewWriter(f), SplitFile: SplitFile{Name: f.Name()}}
+				outputs[name] = out
+			}
+			if len(out.pending) == 0 {
+				touched = append(touched, out)
+			}
+			out.pending = append(out.pending, msg.Frame...)
+			out.Frames++
+			out.Bytes += int64(len(msg.Frame))
+		}
+		for _, out := range touched {
+			var err error
+			if opts.Timestamped {
+				_, err = out.w.Write(appendRecord(nil, t, out.pending))
+			} else {
+				_, err = out.w.Write(out.pending)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %v", out.Name, err)
+			}
+			out.pending = out.pending[:0]
+		}
+		return nil
+	}
+
+	err = readCapture(r, opts.Timestamped, split)
+	for _, out := range outputs {
+		if ferr := out.w.Flush(); ferr != nil && err == nil {
+			err = fmt.Errorf("failed to write %s: %v", out.Name, ferr)
+		}
+		if cerr := out.file.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to write %s: %v", out.Name, cerr)
+		}
+		result.Files = append(result.Files, out.SplitFile)
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].Name < result.Files[j].Name })
+	result.Discarded = framer.Discarded
+	result.CRCErrors = framer.CRCErrors
+	result.Truncated = framer.Pending()
+	return result, err
+}
+
+// readCapture passes the chunks of a capture to fn, with their arrival
+// time for a timestamped one. A record cut short at the end, as by a
+// crash mid-write, ends the capture.
+func readCapture(r io.Reader, timestamped bool, fn func(data []byte, t time.Time) error) error {
+	if timestamped {
+		rr := NewRecordReader(r)
+		for {
+			rec, err := rr.Next()
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(rec.Data, rec.Time); err != nil {
+				return err
+			}
+		}
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := fn(buf[:n], time.Time{}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package ntrip
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stats is the runtime state reported by the /stats endpoint
+type Stats struct {
+	Uptime           float64 `json:"uptime_seconds"`
+	ClientCount      int     `json:"client_count"`
+	BytesRead        int64   `json:"bytes_read"`
+	SerialReconnects int     `json:"serial_reconnects"`
+	Accepted         int64   `json:"accepted_connections"`
+	Rejected         int64   `json:"rejected_connections"`
+	// SourceHealthy is false while any source is silent past its data
+	// timeout
+	SourceHealthy bool          `json:"source_healthy"`
+	Sources       []SourceStats `json:"sources"`
+	Mountpoints   []MountStats  `json:"mountpoints"`
+	Clients       []ClientStats `json:"clients"`
+}
+
+// MountStats reports the traffic of a mountpoint. Bitrate is the rate of
+// source data in bits per second, averaged over about ten seconds.
+// Forwarded and Filtered count frames passed and removed by a message type
+// filter.
+type MountStats struct {
+	Name        string    `json:"name"`
+	ClientCount int       `json:"client_count"`
+	BytesIn     int64     `json:"bytes_received"`
+	BytesSent   int64     `json:"bytes_forwarded"`
+	LastData    time.Time `json:"last_data"`
+	Bitrate     int       `json:"bitrate"`
+	Forwarded   int64     `json:"messages_forwarded"`
+	Filtered    int64     `json:"messages_filtered"`
+}
+
+type SourceStats struct {
+	Name       string `json:"name"`
+	BytesRead  int64  `json:"bytes_read"`
+	Reconnects int    `json:"reconnects"`
+	// BufferSize, BufferHighWater and BufferDropped describe the buffer
+	// between reading the source and sending to clients
+	BufferSize      int   `json:"buffer_size"`
+	BufferHighWater int   `json:"buffer_high_water"`
+	BufferDropped   int64 `json:"buffer_dropped_bytes"`
+	// Healthy is false while the source is silent past its data timeout
+	Healthy bool `json:"source_healthy"`
+	// Idle is set while an on-demand source is disconnected for lack of
+	// clients
+	Idle bool `json:"idle,omitempty"`
+	// GGA is the last position the receiver reported in NMEA, for
+	// sources with split_nmea
+	GGA      *GGAPosition `json:"gga,omitempty"`
+	LastData time.Time    `json:"last_data"`
+	// Messages counts the RTCM frames read from the source by type
+	Messages map[int]int64 `json:"messages"`
+}
+
+type ClientStats struct {
+	// ID is the connection ID the server logs the client with, and
+	// disconnects it by
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Mountpoint string    `json:"mountpoint"`
+	Connected  time.Time `json:"connected"`
+	BytesSent  int64     `json:"bytes_sent"`
+}
+
+// MountClients lists the clients of a mountpoint, oldest connection first
+type MountClients struct {
+	Name        string        `json:"name"`
+	ClientCount int           `json:"client_count"`
+	Clients     []ClientStats `json:"clients"`
+}
+
+// stats reports a client. The caller holds s.mu.
+func (c *clientConn) stats() ClientStats {
+	return ClientStats{
+		ID:         c.id,
+		RemoteAddr: c.conn.RemoteAddr().String(),
+		User:       c.user,
+		Mountpoint: c.mount.name,
+		Connected:  c.connected,
+		BytesSent:  c.bytesSent,
+	}
+}
+
+// Stats returns a snapshot of the server counters
+func (s *Server) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{
+		Uptime:        time.Since(s.started).Seconds(),
+		Accepted:      s.accepted,
+		Rejected:      s.rejected,
+		SourceHealthy: true,
+		Sources:       []SourceStats{},
+		Mountpoints:   []MountStats{},
+		Clients:       []ClientStats{},
+	}
+	for _, src := range s.sources {
+		if len(src.mounts) == 0 {
+			continue
+		}
+		stats.BytesRead += src.bytesRead
+		stats.SerialReconnects += src.reconnects
+		size, highWater, dropped := src.buffer.stats()
+		stats.Sources = append(stats.Sources, SourceStats{
+			Name:            src.name,
+			BytesRead:       src.bytesRead,
+			Reconnects:      src.reconnects,
+			BufferSize:      size,
+			BufferHighWater: highWater,
+			BufferDropped:   dropped,
+			Healthy:         !src.silent,
+			Idle:            src.config.OnDemand && !src.demanded,
+			GGA:             src.gga,
+			LastData:        src.lastRead,
+			Messages:        maps.Clone(src.messages),
+		})
+		if src.silent {
+			stats.SourceHealthy = false
+		}
+	}
+	for _, m := range s.mounts {
+		stats.Mountpoints = append(stats.Mountpoints, MountStats{
+			Name:        m.name,
+			ClientCount: len(m.clients),
+			BytesIn:     m.bytesIn,
+			BytesSent:   m.bytesSent,
+			LastData:    m.lastData,
+			Bitrate:     m.bitrate(),
+			Forwarded:   m.forwarded,
+			Filtered:    m.filtered,
+		})
+		for _, c := range m.clients {
+			stats.Clients = append(stats.Clients, c.stats())
+		}
+	}
+	slices.SortFunc(stats.Mountpoints, func(a, b MountStats) int { return strings.Compare(a.Name, b.Name) })
+	stats.ClientCount = len(stats.Clients)
+	return stats
+}
+
+// Clients returns the connected clients of every mountpoint, ordered by
+// name
+func (s *Server) Clients() []MountClients {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mounts := make([]MountClients, 0, len(s.mounts))
+	for _, m := range s.mounts {
+		mc := MountClients{Name: m.name, ClientCount: len(m.clients), Clients: []ClientStats{}}
+		for _, c := range m.clients {
+			mc.Clients = append(mc.Clients, c.stats())
+		}
+		slices.SortFunc(mc.Clients, func(a, b ClientStats) int { return a.Connected.Compare(b.Connected) })
+		mounts = append(mounts, mc)
+	}
+	slices.SortFunc(mounts, func(a, b MountClients) int { return strings.Compare(a.Name, b.Name) })
+	return mounts
+}
+
+// startAdmin serves the admin and metrics HTTP endpoints on their own
+// addresses so they are not exposed on the caster port. Either is
+// disabled without an address.
+func (s *Server) startAdmin() {
+	adminAddr, metricsAddr := s.config.Admin.Addr, s.config.Metrics.Addr
+	if adminAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/stats", s.handleStats)
+		mux.HandleFunc("/healthz", s.handleHealthz)
+		mux.HandleFunc("/readyz", s.handleReadyz)
+		mux.HandleFunc("/clients", s.handleClients)
+		mux.HandleFunc("/clients/disconnect", s.handleDisconnect)
+		if metricsAddr == adminAddr {
+			mux.HandleFunc("/metrics", s.handleMetrics)
+		}
+		s.admin = s.serveHTTP("Admin", adminAddr, mux)
+	}
+	if metricsAddr != "" && metricsAddr != adminAddr {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", s.handleMetrics)
+		s.metrics = s.serveHTTP("Metrics", metricsAddr, mux)
+	}
+}
+
+// serveHTTP runs an HTTP server on addr until shutdown closes it
+func (s *Server) serveHTTP(name, addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	s.spawn(func() {
+		slog.Info(name+" server started", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error(name+" server error", "err", err)
+		}
+	})
+	return srv
+}
+
+// handleHealthz answers liveness probes, the process is up if it answers
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz answers readiness probes: 200 while the caster is listening
+// and every source in use is connected and, with a data timeout, sending
+// data; 503 listing the problems otherwise
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	problems := s.readiness()
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, p := range problems {
+			fmt.Fprintln(w, p)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// readiness returns why the server should not get traffic, if anything
+func (s *Server) readiness() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var problems []string
+	if s.started.IsZero() || s.ctx.Err() != nil {
+		problems = append(problems, "not listening")
+	} else if s.draining {
+		problems = append(problems, "draining")
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.sources)) {
+		src := s.sources[name]
+		switch {
+		case len(src.mounts) == 0:
+		case src.config.OnDemand && !src.demanded:
+		case !src.open:
+			problems = append(problems, fmt.Sprintf("source %s is not connected", name))
+		case src.silent:
+			problems = append(problems, fmt.Sprintf("source %s sent no data for %ds", name, src.config.DataTimeout))
+		}
+	}
+	return problems
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Stats()); err != nil {
+		slog.Error("Error encoding stats", "err", err)
+	}
+}
+
+// handleClients lists the connected clients of each mountpoint
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Clients()); err != nil {
+		slog.Error("Error encoding clients", "err", err)
+	}
+}
+
+// handleDisconnect drops the client whose connection ID is posted as
+// {"id": "ab12cd"}. Only a JSON POST from no or the same origin is
+// accepted: a web page the operator visits can post a form to the admin
+// server, but cannot send JSON there without the browser asking first.
+// With admin.token set the request must also carry the token.
+func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			slog.Warn("Refusing cross-origin admin request", "origin", origin, "remote", r.RemoteAddr)
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+	}
+	if token := s.config.Admin.Token; token != "" {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "expected a JSON body", http.StatusUnsupportedMediaType)
+		return
+	}
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body.ID == "" || !s.Disconnect(body.ID) {
+		http.Error(w, fmt.Sprintf("no client %q", body.ID), http.StatusNotFound)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
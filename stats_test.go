@@ -0,0 +1,64 @@
+package ntrip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDisconnectRequest(t *testing.T) {
+	path, _ := testCapture(t)
+	var config Config
+	config.Serial = SerialConfig{Type: "file", Path: path, Loop: true, Rate: 100}
+	config.Mountpoints = []MountpointConfig{{Name: "RTCM3"}}
+	config.Admin.Token = "s3cret"
+	s, addr := startServerConfig(t, config)
+	dialMount(t, addr, NtripV1)
+	waitFor(t, "the client to connect", func() bool { return clientCount(s) == 1 })
+	id := s.Clients()[0].Clients[0].ID
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		contentType string
+		token       string
+		body        string
+		status      int
+	}{
+		{name: "GET", method: "GET", status: http.StatusMethodNotAllowed},
+		{name: "cross-site form", method: "POST", origin: "https://evil.example", contentType: "application/x-www-form-urlencoded", token: "s3cret", body: "id=" + id, status: http.StatusForbidden},
+		{name: "cross-site JSON", method: "POST", origin: "https://evil.example", contentType: "application/json", token: "s3cret", body: `{"id":"` + id + `"}`, status: http.StatusForbidden},
+		{name: "form", method: "POST", contentType: "application/x-www-form-urlencoded", token: "s3cret", body: "id=" + id, status: http.StatusUnsupportedMediaType},
+		{name: "plain text", method: "POST", contentType: "text/plain", token: "s3cret", body: `{"id":"` + id + `"}`, status: http.StatusUnsupportedMediaType},
+		{name: "no token", method: "POST", contentType: "application/json", body: `{"id":"` + id + `"}`, status: http.StatusUnauthorized},
+		{name: "wrong token", method: "POST", contentType: "application/json", token: "guess", body: `{"id":"` + id + `"}`, status: http.StatusUnauthorized},
+		{name: "invalid JSON", method: "POST", contentType: "application/json", token: "s3cret", body: "id=" + id, status: http.StatusBadRequest},
+		{name: "unknown client", method: "POST", contentType: "application/json", token: "s3cret", body: `{"id":"000000"}`, status: http.StatusNotFound},
+		{name: "same origin", method: "POST", origin: "http://example.com", contentType: "application/json; charset=utf-8", token: "s3cret", body: `{"id":"` + id + `"}`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com/clients/disconnect", strings.NewReader(tt.body))
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			s.handleDisconnect(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, strings.TrimSpace(w.Body.String()))
+			}
+			if tt.status != http.StatusOK && clientCount(s) != 1 {
+				t.Fatal("refused request disconnected the client")
+			}
+		})
+	}
+	waitFor(t, "the client to be disconnected", func() bool { return clientCount(s) == 0 })
+}
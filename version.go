@@ -0,0 +1,8 @@
+package ntrip
+
+// Version identifies the build in the caster's Server header, the
+// client's default User-Agent and the startup logs. Release builds set it
+// at link time:
+//
+//	go build -ldflags "-X ntrip.Version=1.4.0" ./cmd/ntrip-server
+var Version = "dev"